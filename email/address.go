@@ -0,0 +1,251 @@
+package email
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxRecipients is the maximum number of unique To, Cc and Bcc recipients of a single email.
+const MaxRecipients = 1000
+
+// ParseAddress parses an address with an optional display name ("Jane <jane@example.com>") and normalizes the domain to
+// lowercase ASCII, internationalized domains are converted to punycode. Only the punycode conversion of IDNA is done,
+// labels are expected to already be in normalized form.
+func ParseAddress(address string) (*mail.Address, error) {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	at := strings.LastIndexByte(addr.Address, '@')
+	if at <= 0 {
+		return nil, fmt.Errorf("missing local part")
+	}
+	domain, err := domainToASCII(addr.Address[at+1:])
+	if err != nil {
+		return nil, err
+	}
+	addr.Address = addr.Address[:at+1] + domain
+	return addr, nil
+}
+
+func domainToASCII(domain string) (string, error) {
+	labels := strings.Split(strings.ToLower(domain), ".")
+	for i, label := range labels {
+		if label == "" {
+			return "", fmt.Errorf("empty label in domain (%s)", domain)
+		}
+		if !isASCII(label) {
+			encoded, err := punycode(label)
+			if err != nil {
+				return "", fmt.Errorf("encoding domain (%s): %w", domain, err)
+			}
+			label = "xn--" + encoded
+		}
+		if len(label) > 63 {
+			return "", fmt.Errorf("label too long in domain (%s)", domain)
+		}
+		labels[i] = label
+	}
+	ascii := strings.Join(labels, ".")
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("domain too long (%s)", domain)
+	}
+	return ascii, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// punycode encodes s according to RFC 3492.
+func punycode(s string) (string, error) {
+	runes := []rune(s)
+	out := make([]byte, 0, len(s)+8)
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for handled < len(runes) {
+		m := math.MaxInt32
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		if (m - n) > (math.MaxInt32-delta)/(handled+1) {
+			return "", fmt.Errorf("punycode overflow")
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+type InvalidAddress struct {
+	Field   string
+	Address string
+	Err     error
+}
+
+func (a InvalidAddress) Error() string {
+	return fmt.Sprintf("%s (%s): %s", a.Field, a.Address, a.Err)
+}
+
+// ValidationError lists every problem found when validating an email.
+type ValidationError struct {
+	Problems  []string
+	Addresses []InvalidAddress
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, 0, len(v.Problems)+len(v.Addresses))
+	msgs = append(msgs, v.Problems...)
+	for _, a := range v.Addresses {
+		msgs = append(msgs, a.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (v *ValidationError) add(problem string) {
+	v.Problems = append(v.Problems, problem)
+}
+
+func (v *ValidationError) checkAddress(field, address string) {
+	if _, err := ParseAddress(address); err != nil {
+		v.Addresses = append(v.Addresses, InvalidAddress{Field: field, Address: address, Err: err})
+	}
+}
+
+func (v *ValidationError) orNil() error {
+	if len(v.Problems) == 0 && len(v.Addresses) == 0 {
+		return nil
+	}
+	return v
+}
+
+func normalizeAddress(address string) string {
+	addr, err := ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return addr.String()
+}
+
+func recipientKey(address string) string {
+	if addr, err := ParseAddress(address); err == nil {
+		return strings.ToLower(addr.Address)
+	}
+	return strings.ToLower(address)
+}
+
+// Normalized returns a copy of the email with all addresses normalized and recipients deduplicated across To, Cc and
+// Bcc, keeping the first occurrence in that order. Invalid addresses are left untouched.
+func (e *Email) Normalized() *Email {
+	c := *e
+	c.From = normalizeAddress(e.From)
+	if e.ReplyTo != "" {
+		c.ReplyTo = normalizeAddress(e.ReplyTo)
+	}
+	seen := make(map[string]struct{})
+	dedupe := func(addresses []string) []string {
+		var res []string
+		for _, a := range addresses {
+			key := recipientKey(a)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			res = append(res, normalizeAddress(a))
+		}
+		return res
+	}
+	c.To = dedupe(e.To)
+	c.Cc = dedupe(e.Cc)
+	c.Bcc = dedupe(e.Bcc)
+	return &c
+}
+
+func uniqueRecipients(e *Email) int {
+	seen := make(map[string]struct{})
+	for _, list := range [][]string{e.To, e.Cc, e.Bcc} {
+		for _, a := range list {
+			seen[recipientKey(a)] = struct{}{}
+		}
+	}
+	return len(seen)
+}
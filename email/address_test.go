@@ -0,0 +1,66 @@
+package email_test
+
+import (
+	"errors"
+	"github.com/SimonSchneider/goslu/email"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		in      string
+		name    string
+		address string
+	}{
+		{in: "jane@example.com", address: "jane@example.com"},
+		{in: "Jane Doe <Jane@EXAMPLE.com>", name: "Jane Doe", address: "Jane@example.com"},
+		{in: "hans@bücher.de", address: "hans@xn--bcher-kva.de"},
+		{in: "<info@München.Example>", address: "info@xn--mnchen-3ya.example"},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			addr, err := email.ParseAddress(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr.Name != test.name || addr.Address != test.address {
+				t.Fatalf("unexpected address: %q <%s>", addr.Name, addr.Address)
+			}
+		})
+	}
+	for _, invalid := range []string{"", "jane", "jane@", "@example.com", "jane@example..com"} {
+		if _, err := email.ParseAddress(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestValidateReportsAllAddresses(t *testing.T) {
+	e := &email.Email{From: "nope", To: []string{"ok@x.com", "bad"}, Bcc: []string{"also bad"}, Text: "hi"}
+	err := e.Validate()
+	var verr *email.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if len(verr.Addresses) != 3 || verr.Addresses[0].Field != "from" || verr.Addresses[2].Field != "bcc" {
+		t.Fatalf("unexpected addresses: %+v", verr.Addresses)
+	}
+	if len(verr.Problems) != 1 {
+		t.Fatalf("unexpected problems: %v", verr.Problems)
+	}
+}
+
+func TestNormalizedDedupesRecipients(t *testing.T) {
+	e := (&email.Email{
+		From: "Jane <jane@Example.com>",
+		To:   []string{"a@x.com", "A@X.com"},
+		Cc:   []string{"Bob <b@x.com>", "a@x.com"},
+		Bcc:  []string{"b@x.com", "c@x.com"},
+	}).Normalized()
+	if e.From != `"Jane" <jane@example.com>` {
+		t.Errorf("unexpected from: %s", e.From)
+	}
+	if len(e.To) != 1 || len(e.Cc) != 1 || len(e.Bcc) != 1 || e.Bcc[0] != "<c@x.com>" {
+		t.Errorf("unexpected recipients: %v %v %v", e.To, e.Cc, e.Bcc)
+	}
+}
@@ -1,28 +1,98 @@
 package email
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+type Attachment struct {
+	// Name is the filename of the attachment, for inline attachments it is also the Content-ID
+	// used to reference it from the HTML body (e.g. <img src="cid:logo.png">).
+	Name        string
+	ContentType string
+	Content     io.Reader
+}
 
 type Email struct {
 	From    string
 	To      []string
 	Cc      []string
 	Bcc     []string
+	ReplyTo string
 	Subject string
-	Body    string
+	Text    string
+	HTML    string
+	// Deprecated: Body is the HTML body, use HTML. It is only used when HTML is empty.
+	Body        string
+	Attachments []Attachment
+	Inline      []Attachment
+	Headers     map[string]string
+}
+
+// html returns the HTML body, falling back to the deprecated Body.
+func (e *Email) html() string {
+	if e.HTML != "" {
+		return e.HTML
+	}
+	return e.Body
 }
 
+// Validate reports all problems with the email as a *ValidationError.
 func (e *Email) Validate() error {
+	v := &ValidationError{}
 	if e.From == "" {
-		return fmt.Errorf("from is required")
+		v.add("from is required")
+	} else {
+		v.checkAddress("from", e.From)
 	}
 	if len(e.To) == 0 {
-		return fmt.Errorf("to is required")
+		v.add("to is required")
+	}
+	for _, a := range e.To {
+		v.checkAddress("to", a)
+	}
+	for _, a := range e.Cc {
+		v.checkAddress("cc", a)
+	}
+	for _, a := range e.Bcc {
+		v.checkAddress("bcc", a)
+	}
+	if e.ReplyTo != "" {
+		v.checkAddress("reply-to", e.ReplyTo)
+	}
+	if n := uniqueRecipients(e); n > MaxRecipients {
+		v.add(fmt.Sprintf("too many recipients: %d > %d", n, MaxRecipients))
 	}
 	if e.Subject == "" {
-		return fmt.Errorf("subject is required")
+		v.add("subject is required")
+	}
+	if e.Text == "" && e.html() == "" {
+		v.add("text or html body is required")
+	}
+	for _, a := range slices.Concat(e.Attachments, e.Inline) {
+		if a.Name == "" {
+			v.add("attachment name is required")
+		} else if a.Content == nil {
+			v.add(fmt.Sprintf("attachment (%s) content is required", a.Name))
+		}
+	}
+	return v.orNil()
+}
+
+// reader rewinds the content if possible so that attachments can be sent multiple times (e.g. on retry).
+func (a *Attachment) reader() (io.Reader, error) {
+	if s, ok := a.Content.(io.Seeker); ok {
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("rewinding attachment (%s): %w", a.Name, err)
+		}
 	}
-	if e.Body == "" {
-		return fmt.Errorf("body is required")
+	return a.Content, nil
+}
+
+func (a *Attachment) contentType() string {
+	if a.ContentType == "" {
+		return "application/octet-stream"
 	}
-	return nil
+	return a.ContentType
 }
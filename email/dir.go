@@ -0,0 +1,118 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Dir is a Sender for development that stores every email as a file instead of sending it. Either as <time>.eml files
+// directly in Path or, if Maildir is set, in the new/ folder of a Maildir at Path.
+type Dir struct {
+	Path    string
+	Maildir bool
+	// Signer optionally signs every message, e.g. to inspect a DKIMSigner during development.
+	Signer MessageSigner
+}
+
+func NewDir(path string) *Dir {
+	return &Dir{Path: path}
+}
+
+func NewMaildir(path string) *Dir {
+	return &Dir{Path: path, Maildir: true}
+}
+
+func (d *Dir) msgDir() string {
+	if d.Maildir {
+		return filepath.Join(d.Path, "new")
+	}
+	return d.Path
+}
+
+func (d *Dir) SendEmail(ctx context.Context, email *Email) (string, error) {
+	if err := email.Validate(); err != nil {
+		return "", fmt.Errorf("validating email: %w", err)
+	}
+	email = email.Normalized()
+	messageID, err := NewMessageID(email.From)
+	if err != nil {
+		return "", err
+	}
+	msg, err := email.MIME(messageID)
+	if err != nil {
+		return "", fmt.Errorf("building message: %w", err)
+	}
+	if d.Signer != nil {
+		if msg, err = d.Signer.Sign(msg); err != nil {
+			return "", err
+		}
+	}
+	id := strings.Trim(messageID, "<>")
+	id = id[:strings.IndexByte(id, '@')]
+	if d.Maildir {
+		return messageID, d.writeMaildir(id, msg)
+	}
+	if err := os.MkdirAll(d.Path, 0o755); err != nil {
+		return "", fmt.Errorf("creating dir: %w", err)
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), id)
+	if err := os.WriteFile(filepath.Join(d.Path, name), msg, 0o644); err != nil {
+		return "", fmt.Errorf("writing email: %w", err)
+	}
+	return messageID, nil
+}
+
+// writeMaildir delivers the message by writing it to tmp/ and then moving it into new/ as described in maildir(5).
+func (d *Dir) writeMaildir(id string, msg []byte) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(d.Path, sub), 0o755); err != nil {
+			return fmt.Errorf("creating maildir: %w", err)
+		}
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	name := fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), id, strings.NewReplacer("/", "\\057", ":", "\\072").Replace(host))
+	tmp := filepath.Join(d.Path, "tmp", name)
+	if err := os.WriteFile(tmp, msg, 0o644); err != nil {
+		return fmt.Errorf("writing email: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(d.Path, "new", name)); err != nil {
+		return fmt.Errorf("delivering email: %w", err)
+	}
+	return nil
+}
+
+// messages returns the file names of all stored messages, newest first.
+func (d *Dir) messages() ([]string, error) {
+	entries, err := os.ReadDir(d.msgDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() && (d.Maildir || strings.HasSuffix(e.Name(), ".eml")) {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+	slices.Reverse(names)
+	return names, nil
+}
+
+func (d *Dir) open(name string) (fs.File, error) {
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fs.ErrNotExist
+	}
+	return os.Open(filepath.Join(d.msgDir(), name))
+}
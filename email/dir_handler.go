@@ -0,0 +1,274 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/SimonSchneider/goslu/srvu"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type storedPart struct {
+	ContentType string
+	Filename    string
+	ContentID   string
+	Body        []byte
+}
+
+type storedMessage struct {
+	Name    string
+	Header  mail.Header
+	Subject string
+	Parts   []storedPart
+}
+
+func decodeHeader(v string) string {
+	if d, err := new(mime.WordDecoder).DecodeHeader(v); err == nil {
+		return d
+	}
+	return v
+}
+
+func (m *storedMessage) firstPart(contentType string) (int, bool) {
+	for i, p := range m.Parts {
+		if p.ContentType == contentType && p.Filename == "" {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (m *storedMessage) Text() string {
+	if i, ok := m.firstPart("text/plain"); ok {
+		return string(m.Parts[i].Body)
+	}
+	return ""
+}
+
+func (m *storedMessage) HasHTML() bool {
+	_, ok := m.firstPart("text/html")
+	return ok
+}
+
+func (m *storedMessage) Attachments() map[int]storedPart {
+	res := make(map[int]storedPart)
+	for i, p := range m.Parts {
+		if p.Filename != "" && p.ContentID == "" {
+			res[i] = p
+		}
+	}
+	return res
+}
+
+func readParts(parts []storedPart, header mail.Header, body io.Reader) ([]storedPart, error) {
+	ct := header.Get("Content-Type")
+	if ct == "" {
+		ct = "text/plain"
+	}
+	mt, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return nil, fmt.Errorf("parsing content type: %w", err)
+	}
+	if strings.HasPrefix(mt, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := r.NextPart()
+			if errors.Is(err, io.EOF) {
+				return parts, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading part: %w", err)
+			}
+			if parts, err = readParts(parts, mail.Header(p.Header), p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// multipart.Reader decodes quoted-printable parts itself, but not the body of a single part message
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	p := storedPart{ContentType: mt, Body: b, ContentID: strings.Trim(header.Get("Content-Id"), "<>")}
+	if _, dparams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		p.Filename = dparams["filename"]
+	}
+	return append(parts, p), nil
+}
+
+func (d *Dir) read(name string) (*storedMessage, error) {
+	f, err := d.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading message (%s): %w", name, err)
+	}
+	parts, err := readParts(nil, msg.Header, msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading message (%s): %w", name, err)
+	}
+	return &storedMessage{Name: name, Header: msg.Header, Subject: decodeHeader(msg.Header.Get("Subject")), Parts: parts}, nil
+}
+
+var dirTemplates = template.Must(template.New("").Parse(`
+{{define "head"}}<!DOCTYPE html><html><head><meta charset="utf-8"><title>{{.}}</title>
+<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}td,th{padding:.3em .8em;text-align:left;border-bottom:1px solid #ddd}iframe{width:100%;height:70vh;border:1px solid #ddd}</style></head><body>{{end}}
+{{define "index"}}{{template "head" "Emails"}}<h1>Emails</h1>
+{{if not .}}<p>No emails yet.</p>{{else}}<table><tr><th>Date</th><th>From</th><th>To</th><th>Subject</th></tr>
+{{range .}}<tr><td>{{.Header.Get "Date"}}</td><td>{{.Header.Get "From"}}</td><td>{{.Header.Get "To"}}</td><td><a href="{{.Name}}">{{.Subject}}</a></td></tr>
+{{end}}</table>{{end}}</body></html>{{end}}
+{{define "message"}}{{template "head" .Subject}}<p><a href="./">&larr; all emails</a> | <a href="{{.Name}}/raw">raw</a></p>
+<table>{{range $k := .HeaderKeys}}<tr><th>{{$k}}</th><td>{{$.Message.Header.Get $k}}</td></tr>{{end}}</table>
+<h2>{{.Subject}}</h2>
+{{with .Attachments}}<p>Attachments: {{range $i, $a := .}}<a href="{{$.Name}}/part/{{$i}}">{{$a.Filename}}</a> {{end}}</p>{{end}}
+{{if .HasHTML}}<iframe sandbox src="{{.Name}}/html"></iframe>{{end}}
+{{with .Text}}<pre>{{.}}</pre>{{end}}</body></html>{{end}}
+`))
+
+// Handler lists and previews the stored emails, mount it with http.StripPrefix.
+func (d *Dir) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /{$}", srvu.ErrHandlerFunc(d.serveIndex))
+	mux.Handle("GET /{name}", srvu.ErrHandlerFunc(d.serveMessage))
+	mux.Handle("GET /{name}/raw", srvu.ErrHandlerFunc(d.serveRaw))
+	mux.Handle("GET /{name}/html", srvu.ErrHandlerFunc(d.serveHTML))
+	mux.Handle("GET /{name}/part/{idx}", srvu.ErrHandlerFunc(d.servePart))
+	mux.Handle("GET /{name}/cid/{cid}", srvu.ErrHandlerFunc(d.serveCID))
+	return mux
+}
+
+func (d *Dir) readRequested(r *http.Request) (*storedMessage, error) {
+	msg, err := d.read(r.PathValue("name"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, srvu.ErrStr(http.StatusNotFound, "email not found")
+	}
+	return msg, err
+}
+
+func (d *Dir) serveIndex(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	names, err := d.messages()
+	if err != nil {
+		return fmt.Errorf("listing emails: %w", err)
+	}
+	msgs := make([]*storedMessage, 0, len(names))
+	for _, name := range names {
+		msg, err := d.read(name)
+		if err != nil {
+			srvu.GetLogger(ctx).Printf("email dir: %s", err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return dirTemplates.ExecuteTemplate(w, "index", msgs)
+}
+
+func (d *Dir) serveMessage(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	msg, err := d.readRequested(r)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return dirTemplates.ExecuteTemplate(w, "message", map[string]any{
+		"Name":        url.PathEscape(msg.Name),
+		"Subject":     msg.Subject,
+		"Message":     msg,
+		"HeaderKeys":  []string{"Date", "From", "To", "Cc", "Reply-To", "Message-Id"},
+		"Attachments": msg.Attachments(),
+		"HasHTML":     msg.HasHTML(),
+		"Text":        msg.Text(),
+	})
+}
+
+func (d *Dir) serveRaw(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	f, err := d.open(r.PathValue("name"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return srvu.ErrStr(http.StatusNotFound, "email not found")
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// sandbox serves captured content, which is untrusted, in a unique origin without scripts even when it is opened
+// directly instead of in the sandboxed iframe.
+func sandbox(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
+
+func (d *Dir) serveHTML(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	msg, err := d.readRequested(r)
+	if err != nil {
+		return err
+	}
+	i, ok := msg.firstPart("text/html")
+	if !ok {
+		return srvu.ErrStr(http.StatusNotFound, "email has no html body")
+	}
+	// inline images are referenced as cid:<name>, point them to the cid endpoint
+	body := strings.ReplaceAll(string(msg.Parts[i].Body), `"cid:`, `"cid/`)
+	sandbox(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = io.WriteString(w, body)
+	return err
+}
+
+func servePartBody(w http.ResponseWriter, p storedPart) error {
+	sandbox(w)
+	w.Header().Set("Content-Type", p.ContentType)
+	if p.Filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": p.Filename}))
+	}
+	_, err := w.Write(p.Body)
+	return err
+}
+
+func (d *Dir) servePart(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	msg, err := d.readRequested(r)
+	if err != nil {
+		return err
+	}
+	idx, err := strconv.Atoi(r.PathValue("idx"))
+	if err != nil || idx < 0 || idx >= len(msg.Parts) {
+		return srvu.ErrStr(http.StatusNotFound, "part not found")
+	}
+	return servePartBody(w, msg.Parts[idx])
+}
+
+func (d *Dir) serveCID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	msg, err := d.readRequested(r)
+	if err != nil {
+		return err
+	}
+	cid := r.PathValue("cid")
+	for _, p := range msg.Parts {
+		if p.ContentID == cid {
+			return servePartBody(w, p)
+		}
+	}
+	return srvu.ErrStr(http.StatusNotFound, "inline content not found")
+}
@@ -0,0 +1,91 @@
+package email_test
+
+import (
+	"context"
+	"github.com/SimonSchneider/goslu/email"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	for _, maildir := range []bool{false, true} {
+		dir := &email.Dir{Path: t.TempDir(), Maildir: maildir}
+		_, err := dir.SendEmail(context.Background(), &email.Email{
+			From:    "a@x.com",
+			To:      []string{"b@x.com"},
+			Subject: "Welcome",
+			Text:    "hello text",
+			HTML:    `<p>hello html</p><img src="cid:logo.png">`,
+			Inline:  []email.Attachment{{Name: "logo.png", ContentType: "image/png", Content: strings.NewReader("png")}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pattern := "*.eml"
+		if maildir {
+			pattern = filepath.Join("new", "*")
+		}
+		files, err := filepath.Glob(filepath.Join(dir.Path, pattern))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("expected one file, got %v (%v)", files, err)
+		}
+		name := filepath.Base(files[0])
+		srv := httptest.NewServer(http.StripPrefix("/emails", dir.Handler()))
+		for path, expected := range map[string]string{
+			"/emails/":                          "Welcome",
+			"/emails/" + name:                   "hello text",
+			"/emails/" + name + "/html":         `<img src="cid/logo.png">`,
+			"/emails/" + name + "/cid/logo.png": "png",
+		} {
+			res, err := http.Get(srv.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK || !strings.Contains(string(b), expected) {
+				t.Errorf("%s: unexpected response %d: %s", path, res.StatusCode, b)
+			}
+			if csp := res.Header.Get("Content-Security-Policy"); strings.HasSuffix(path, "/html") || strings.Contains(path, "/cid/") {
+				if csp != "sandbox" {
+					t.Errorf("%s: expected captured content to be sandboxed, got %q", path, csp)
+				}
+			}
+		}
+		res, err := http.Get(srv.URL + "/emails/missing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("expected not found, got %d", res.StatusCode)
+		}
+		srv.Close()
+		if _, err := os.Stat(filepath.Join(dir.Path, "tmp")); maildir && err != nil {
+			t.Errorf("expected maildir tmp folder: %v", err)
+		}
+	}
+}
+
+func TestDirQuotedPrintable(t *testing.T) {
+	dir := &email.Dir{Path: t.TempDir()}
+	raw := "From: a@x.com\r\nTo: b@x.com\r\nSubject: Hi\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\ncaf=C3=A9 =3D soft=\r\n break\r\n"
+	if err := os.WriteFile(filepath.Join(dir.Path, "qp.eml"), []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(dir.Handler())
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/qp.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(b), "café = soft break") {
+		t.Errorf("unexpected response %d: %s", res.StatusCode, b)
+	}
+}
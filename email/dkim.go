@@ -0,0 +1,198 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MessageSigner signs a raw RFC 5322 message, it is used by the senders that build the MIME message themselves.
+type MessageSigner interface {
+	Sign(msg []byte) ([]byte, error)
+}
+
+var defaultDKIMHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-Id", "Mime-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// DKIMSigner signs messages with DKIM (RFC 6376) using relaxed/relaxed canonicalization. Key is either an
+// *rsa.PrivateKey (rsa-sha256) or an ed25519.PrivateKey (ed25519-sha256, RFC 8463).
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	Key      crypto.Signer
+	// Headers are the header fields to sign if present in the message, defaults to the common fields.
+	Headers []string
+	// Now is used for the signature timestamp, defaults to time.Now.
+	Now func() time.Time
+}
+
+func NewDKIMSigner(domain, selector string, key crypto.Signer) *DKIMSigner {
+	return &DKIMSigner{Domain: domain, Selector: selector, Key: key}
+}
+
+type headerField struct {
+	name string
+	// raw is the complete field including the name and folding but without the final CRLF.
+	raw string
+}
+
+// toCRLF converts bare LF line endings to CRLF.
+func toCRLF(msg []byte) []byte {
+	return bytes.ReplaceAll(bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+}
+
+func splitMessage(msg []byte) ([]headerField, []byte, error) {
+	end := bytes.Index(msg, []byte("\r\n\r\n"))
+	var header, body []byte
+	if end < 0 {
+		header = bytes.TrimSuffix(msg, []byte("\r\n"))
+	} else {
+		header, body = msg[:end], msg[end+4:]
+	}
+	var fields []headerField
+	for _, line := range strings.Split(string(header), "\r\n") {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			if len(fields) == 0 {
+				return nil, nil, fmt.Errorf("header starts with a continuation line")
+			}
+			fields[len(fields)-1].raw += "\r\n" + line
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, nil, fmt.Errorf("malformed header line: %q", line)
+		}
+		fields = append(fields, headerField{name: strings.TrimRight(line[:i], " \t"), raw: line})
+	}
+	return fields, body, nil
+}
+
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == ' ' || c == '\t' {
+			space = true
+		} else {
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteByte(c)
+		}
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// relaxedHeader canonicalizes a header field according to RFC 6376 section 3.4.2, without the trailing CRLF.
+func relaxedHeader(raw string) string {
+	i := strings.IndexByte(raw, ':')
+	name := strings.ToLower(strings.TrimRight(raw[:i], " \t"))
+	value := strings.ReplaceAll(raw[i+1:], "\r\n", "")
+	return name + ":" + strings.TrimSpace(collapseWSP(value))
+}
+
+// relaxedBody canonicalizes a body according to RFC 6376 section 3.4.4.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWSP(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// signedHeaders selects the fields to sign, for repeated fields the last occurrence is used first as described in
+// RFC 6376 section 5.4.2.
+func signedHeaders(fields []headerField, names []string) ([]string, []string) {
+	used := make(map[int]bool)
+	var h, canonical []string
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				h = append(h, strings.ToLower(name))
+				canonical = append(canonical, relaxedHeader(fields[i].raw))
+				break
+			}
+		}
+	}
+	return h, canonical
+}
+
+func dkimHash(canonicalHeaders []string, signatureField string) []byte {
+	hash := sha256.New()
+	for _, c := range canonicalHeaders {
+		hash.Write([]byte(c + "\r\n"))
+	}
+	hash.Write([]byte(relaxedHeader(signatureField)))
+	return hash.Sum(nil)
+}
+
+// Sign prepends a DKIM-Signature header to the message. Bare LF line endings are converted to CRLF.
+func (s *DKIMSigner) Sign(msg []byte) ([]byte, error) {
+	var algorithm string
+	switch s.Key.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		algorithm = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported dkim key type: %T", s.Key)
+	}
+	msg = toCRLF(msg)
+	fields, body, err := splitMessage(msg)
+	if err != nil {
+		return nil, fmt.Errorf("parsing message: %w", err)
+	}
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	names := s.Headers
+	if len(names) == 0 {
+		names = defaultDKIMHeaders
+	}
+	h, canonical := signedHeaders(fields, names)
+	if !slices.Contains(h, "from") {
+		return nil, fmt.Errorf("the from header must be signed")
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	field := fmt.Sprintf("DKIM-Signature: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%s; h=%s; bh=%s; b=",
+		algorithm, s.Domain, s.Selector, strconv.FormatInt(now().Unix(), 10), strings.Join(h, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+	digest := dkimHash(canonical, field)
+	var sig []byte
+	if algorithm == "rsa-sha256" {
+		sig, err = s.Key.Sign(rand.Reader, digest, crypto.SHA256)
+	} else {
+		// RFC 8463 signs the sha256 digest with pure Ed25519
+		sig, err = s.Key.Sign(rand.Reader, digest, crypto.Hash(0))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing message: %w", err)
+	}
+	signed := make([]byte, 0, len(field)+len(msg)+len(sig)*2)
+	signed = append(signed, field...)
+	signed = append(signed, base64.StdEncoding.EncodeToString(sig)...)
+	signed = append(signed, "\r\n"...)
+	return append(signed, msg...), nil
+}
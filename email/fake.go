@@ -2,11 +2,117 @@ package email
 
 import (
 	"context"
+	"fmt"
 	"github.com/SimonSchneider/goslu/sid"
+	"slices"
+	"sync"
 )
 
-type Fake struct{}
+type SentEmail struct {
+	ID    string
+	Email Email
+}
+
+type Fake struct {
+	mux    sync.Mutex
+	sent   []SentEmail
+	errors map[string]error
+}
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) SendEmail(ctx context.Context, email *Email) (string, error) {
+	if err := email.Validate(); err != nil {
+		return "", fmt.Errorf("validating email: %w", err)
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for _, r := range slices.Concat(email.To, email.Cc, email.Bcc) {
+		if err, ok := f.errors[recipientKey(r)]; ok {
+			return "", err
+		}
+	}
+	id, err := sid.NewString(15)
+	if err != nil {
+		return "", err
+	}
+	f.sent = append(f.sent, SentEmail{ID: id, Email: cloneEmail(email)})
+	return id, nil
+}
+
+func cloneEmail(e *Email) Email {
+	c := *e
+	c.To = slices.Clone(e.To)
+	c.Cc = slices.Clone(e.Cc)
+	c.Bcc = slices.Clone(e.Bcc)
+	c.Attachments = slices.Clone(e.Attachments)
+	c.Inline = slices.Clone(e.Inline)
+	if e.Headers != nil {
+		c.Headers = make(map[string]string, len(e.Headers))
+		for k, v := range e.Headers {
+			c.Headers[k] = v
+		}
+	}
+	return c
+}
+
+// FailFor makes every email sent to the recipient (To, Cc or Bcc) fail with err, a nil err removes the failure.
+// Recipients are compared by their parsed, lowercased address.
+func (f *Fake) FailFor(recipient string, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	recipient = recipientKey(recipient)
+	if err == nil {
+		delete(f.errors, recipient)
+		return
+	}
+	if f.errors == nil {
+		f.errors = make(map[string]error)
+	}
+	f.errors[recipient] = err
+}
+
+func (f *Fake) Sent() []SentEmail {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return slices.Clone(f.sent)
+}
+
+func (f *Fake) Last() (SentEmail, bool) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if len(f.sent) == 0 {
+		return SentEmail{}, false
+	}
+	return f.sent[len(f.sent)-1], true
+}
+
+// Find returns all emails with the given subject that were sent to the recipient (To, Cc or Bcc),
+// an empty to or subject matches any. Recipients are compared by their parsed, lowercased address.
+func (f *Fake) Find(to, subject string) []SentEmail {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	var found []SentEmail
+	for _, s := range f.sent {
+		if subject != "" && s.Email.Subject != subject {
+			continue
+		}
+		if to != "" && !slices.ContainsFunc(slices.Concat(s.Email.To, s.Email.Cc, s.Email.Bcc), func(r string) bool {
+			return recipientKey(r) == recipientKey(to)
+		}) {
+			continue
+		}
+		found = append(found, s)
+	}
+	return found
+}
 
-func (f Fake) SendEmail(ctx context.Context, email *Email) (string, error) {
-	return sid.NewString(15)
+// Reset clears the sent emails and injected errors.
+func (f *Fake) Reset() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.sent = nil
+	f.errors = nil
 }
@@ -0,0 +1,50 @@
+package email_test
+
+import (
+	"context"
+	"errors"
+	"github.com/SimonSchneider/goslu/email"
+	"testing"
+)
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	f := email.NewFake()
+	if _, err := f.SendEmail(ctx, &email.Email{From: "a@x.com", To: []string{"b@x.com"}}); err == nil {
+		t.Fatal("expected validation error")
+	}
+	id, err := f.SendEmail(ctx, &email.Email{From: "a@x.com", To: []string{"b@x.com"}, Subject: "welcome", Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.SendEmail(ctx, &email.Email{From: "a@x.com", To: []string{"c@x.com"}, Cc: []string{"b@x.com"}, Subject: "reset", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	injected := errors.New("bounced")
+	f.FailFor("d@x.com", injected)
+	if _, err := f.SendEmail(ctx, &email.Email{From: "a@x.com", To: []string{"d@x.com"}, Subject: "welcome", Text: "hi"}); !errors.Is(err, injected) {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+	if _, err := f.SendEmail(ctx, &email.Email{From: "a@x.com", To: []string{"Dee <D@X.com>"}, Subject: "welcome", Text: "hi"}); !errors.Is(err, injected) {
+		t.Fatalf("expected injected error for a display name address, got %v", err)
+	}
+	if len(f.Sent()) != 2 {
+		t.Fatalf("expected 2 sent, got %d", len(f.Sent()))
+	}
+	if last, ok := f.Last(); !ok || last.Email.Subject != "reset" {
+		t.Fatalf("unexpected last: %+v", last)
+	}
+	if found := f.Find("b@x.com", "welcome"); len(found) != 1 || found[0].ID != id {
+		t.Fatalf("unexpected found: %+v", found)
+	}
+	if found := f.Find("b@x.com", ""); len(found) != 2 {
+		t.Fatalf("expected 2 found, got %d", len(found))
+	}
+	if found := f.Find("Bee <B@x.com>", "welcome"); len(found) != 1 {
+		t.Fatalf("expected to find by parsed address, got %d", len(found))
+	}
+	f.Reset()
+	if _, ok := f.Last(); ok || len(f.Sent()) != 0 {
+		t.Fatal("expected reset")
+	}
+}
@@ -5,8 +5,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/SimonSchneider/goslu/srvu"
+	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Mailgun struct {
@@ -16,6 +23,51 @@ type Mailgun struct {
 	DomainName string
 }
 
+// APIError is returned when Mailgun responds with a non 200 status.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Retryable is set for rate limiting and server errors, where sending the same request later may succeed.
+	Retryable bool
+}
+
+func newAPIError(res *http.Response) *APIError {
+	e := &APIError{
+		StatusCode: res.StatusCode,
+		Retryable:  res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError,
+	}
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(b, &body); err == nil && body.Message != "" {
+		e.Message = body.Message
+	} else {
+		e.Message = strings.TrimSpace(string(b))
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("mailgun: unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("mailgun: unexpected status code: %d: %s", e.StatusCode, e.Message)
+}
+
+// StatusError maps the error to a srvu.StatusError for handlers, a rejected request is reported as a bad request,
+// retryable errors as unavailable and everything else (e.g. invalid credentials) as a bad gateway.
+func (e *APIError) StatusError() error {
+	switch {
+	case e.Retryable:
+		return srvu.Err(http.StatusServiceUnavailable, e)
+	case e.StatusCode == http.StatusBadRequest:
+		return srvu.Err(http.StatusBadRequest, e)
+	default:
+		return srvu.Err(http.StatusBadGateway, e)
+	}
+}
+
 func NewMailgun(client *http.Client, baseURL, apiKey, domainName string) *Mailgun {
 	return &Mailgun{
 		Client:     client,
@@ -34,10 +86,176 @@ func addRecipient(w *multipart.Writer, key string, recipients []string) error {
 	return nil
 }
 
+func writeOptionalField(w *multipart.Writer, key, value string) error {
+	if value == "" {
+		return nil
+	}
+	if err := w.WriteField(key, value); err != nil {
+		return fmt.Errorf("writing %s: %w", key, err)
+	}
+	return nil
+}
+
+func addAttachments(w *multipart.Writer, key string, attachments []Attachment) error {
+	for _, a := range attachments {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": key, "filename": a.Name}))
+		h.Set("Content-Type", a.contentType())
+		pw, err := w.CreatePart(h)
+		if err != nil {
+			return fmt.Errorf("writing %s (%s): %w", key, a.Name, err)
+		}
+		r, err := a.reader()
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(pw, r); err != nil {
+			return fmt.Errorf("writing %s (%s): %w", key, a.Name, err)
+		}
+	}
+	return nil
+}
+
+// MailgunOptions are Mailgun specific sending options, they map to the o: and v: fields of the messages API.
+type MailgunOptions struct {
+	Tags []string
+	// DeliveryTime schedules the delivery, Mailgun allows at most 3 days in the future.
+	DeliveryTime time.Time
+	// Tracking, TrackingClicks and TrackingOpens override the domain settings when set. TrackingClicks accepts
+	// "yes", "no" and "htmlonly".
+	Tracking       *bool
+	TrackingClicks string
+	TrackingOpens  *bool
+	// Variables are attached to the message as v: variables and returned in webhook events as user-variables.
+	Variables map[string]string
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func (o *MailgunOptions) write(w *multipart.Writer) error {
+	if o == nil {
+		return nil
+	}
+	for _, tag := range o.Tags {
+		if err := w.WriteField("o:tag", tag); err != nil {
+			return fmt.Errorf("writing tag: %w", err)
+		}
+	}
+	if !o.DeliveryTime.IsZero() {
+		if err := w.WriteField("o:deliverytime", o.DeliveryTime.Format(time.RFC1123Z)); err != nil {
+			return fmt.Errorf("writing delivery time: %w", err)
+		}
+	}
+	if o.Tracking != nil {
+		if err := w.WriteField("o:tracking", yesNo(*o.Tracking)); err != nil {
+			return fmt.Errorf("writing tracking: %w", err)
+		}
+	}
+	if err := writeOptionalField(w, "o:tracking-clicks", o.TrackingClicks); err != nil {
+		return err
+	}
+	if o.TrackingOpens != nil {
+		if err := w.WriteField("o:tracking-opens", yesNo(*o.TrackingOpens)); err != nil {
+			return fmt.Errorf("writing tracking opens: %w", err)
+		}
+	}
+	for k, v := range o.Variables {
+		if err := w.WriteField("v:"+k, v); err != nil {
+			return fmt.Errorf("writing variable (%s): %w", k, err)
+		}
+	}
+	return nil
+}
+
 func (m *Mailgun) SendEmail(ctx context.Context, email *Email) (string, error) {
+	return m.SendEmailWithOptions(ctx, email, nil)
+}
+
+func (m *Mailgun) SendEmailWithOptions(ctx context.Context, email *Email, opts *MailgunOptions) (string, error) {
 	if err := email.Validate(); err != nil {
 		return "", fmt.Errorf("validating email: %w", err)
 	}
+	return m.send(ctx, email.Normalized(), opts, nil)
+}
+
+// MailgunBatchSize is the maximum number of recipients Mailgun accepts in a single batch message.
+const MailgunBatchSize = 1000
+
+type BatchRecipient struct {
+	Address string
+	// Variables are substituted into the subject and body with %recipient.<key>%.
+	Variables map[string]any
+}
+
+// SendBatch sends the email individually to every recipient using Mailgun batch sending, the To of the email is ignored.
+// The recipients are sent in chunks of MailgunBatchSize, one id is returned per chunk. On error the ids of the
+// already sent chunks are returned.
+func (m *Mailgun) SendBatch(ctx context.Context, email *Email, recipients []BatchRecipient, opts *MailgunOptions) ([]string, error) {
+	if len(email.Cc) > 0 || len(email.Bcc) > 0 {
+		return nil, fmt.Errorf("cc and bcc are not supported in batch sending")
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("recipients are required")
+	}
+	// every recipient is validated and deduplicated before the first chunk is sent, so that an invalid address does
+	// not fail the batch half way and a duplicate in another chunk is not mailed twice
+	type parsedRecipient struct {
+		to, address string
+		variables   map[string]any
+	}
+	unique := make([]parsedRecipient, 0, len(recipients))
+	seen := make(map[string]bool, len(recipients))
+	v := &ValidationError{}
+	for _, r := range recipients {
+		addr, err := ParseAddress(r.Address)
+		if err != nil {
+			v.Addresses = append(v.Addresses, InvalidAddress{Field: "to", Address: r.Address, Err: err})
+			continue
+		}
+		key := strings.ToLower(addr.Address)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if r.Variables == nil {
+			r.Variables = map[string]any{}
+		}
+		unique = append(unique, parsedRecipient{to: addr.String(), address: addr.Address, variables: r.Variables})
+	}
+	if err := v.orNil(); err != nil {
+		return nil, fmt.Errorf("validating email: %w", err)
+	}
+	ids := make([]string, 0, (len(unique)+MailgunBatchSize-1)/MailgunBatchSize)
+	for chunk := range slices.Chunk(unique, MailgunBatchSize) {
+		c := *email
+		c.To = make([]string, 0, len(chunk))
+		vars := make(map[string]map[string]any, len(chunk))
+		for _, r := range chunk {
+			c.To = append(c.To, r.to)
+			vars[r.address] = r.variables
+		}
+		if err := c.Validate(); err != nil {
+			return ids, fmt.Errorf("validating email: %w", err)
+		}
+		varsJSON, err := json.Marshal(vars)
+		if err != nil {
+			return ids, fmt.Errorf("encoding recipient variables: %w", err)
+		}
+		id, err := m.send(ctx, c.Normalized(), opts, varsJSON)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (m *Mailgun) send(ctx context.Context, email *Email, opts *MailgunOptions, recipientVariables []byte) (string, error) {
 	data := &bytes.Buffer{}
 	w := multipart.NewWriter(data)
 	defer w.Close()
@@ -56,8 +274,33 @@ func (m *Mailgun) SendEmail(ctx context.Context, email *Email) (string, error) {
 	if err := w.WriteField("subject", email.Subject); err != nil {
 		return "", fmt.Errorf("writing subject: %w", err)
 	}
-	if err := w.WriteField("html", email.Body); err != nil {
-		return "", fmt.Errorf("writing text: %w", err)
+	if err := writeOptionalField(w, "text", email.Text); err != nil {
+		return "", err
+	}
+	if err := writeOptionalField(w, "html", email.html()); err != nil {
+		return "", err
+	}
+	if err := writeOptionalField(w, "h:Reply-To", email.ReplyTo); err != nil {
+		return "", err
+	}
+	for k, v := range email.Headers {
+		if err := writeOptionalField(w, "h:"+k, v); err != nil {
+			return "", err
+		}
+	}
+	if err := addAttachments(w, "attachment", email.Attachments); err != nil {
+		return "", err
+	}
+	if err := addAttachments(w, "inline", email.Inline); err != nil {
+		return "", err
+	}
+	if err := opts.write(w); err != nil {
+		return "", err
+	}
+	if recipientVariables != nil {
+		if err := w.WriteField("recipient-variables", string(recipientVariables)); err != nil {
+			return "", fmt.Errorf("writing recipient variables: %w", err)
+		}
 	}
 	w.Close()
 	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v3/%s/messages", m.BaseURL, m.DomainName), bytes.NewReader(data.Bytes()))
@@ -72,7 +315,7 @@ func (m *Mailgun) SendEmail(ctx context.Context, email *Email) (string, error) {
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", res.StatusCode)
+		return "", newAPIError(res)
 	}
 	var result struct {
 		ID string `json:"id"`
@@ -0,0 +1,182 @@
+//go:debug multipartmaxparts=5000
+
+package email_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SimonSchneider/goslu/email"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mailgunServer(t *testing.T, handle func(r *http.Request) (int, string)) (*email.Mailgun, func()) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		code, body := handle(r)
+		w.WriteHeader(code)
+		fmt.Fprint(w, body)
+	}))
+	return email.NewMailgun(srv.Client(), srv.URL, "key", "mg.example.com"), srv.Close
+}
+
+func TestMailgunSendEmail(t *testing.T) {
+	var form *multipart.Form
+	mg, done := mailgunServer(t, func(r *http.Request) (int, string) {
+		form = r.MultipartForm
+		return http.StatusOK, `{"id":"<1@mg.example.com>"}`
+	})
+	defer done()
+	id, err := mg.SendEmail(context.Background(), &email.Email{
+		From:        "Jane <jane@example.com>",
+		To:          []string{"bob@example.com"},
+		Cc:          []string{"carol@example.com"},
+		ReplyTo:     "support@example.com",
+		Subject:     "Invoice",
+		Text:        "see attached",
+		Body:        "<p>see attached</p><img src=\"cid:logo.png\">",
+		Headers:     map[string]string{"X-Campaign": "jan"},
+		Attachments: []email.Attachment{{Name: "invoice.pdf", ContentType: "application/pdf", Content: strings.NewReader("%PDF")}},
+		Inline:      []email.Attachment{{Name: "logo.png", ContentType: "image/png", Content: strings.NewReader("PNG")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "<1@mg.example.com>" {
+		t.Errorf("unexpected id: %s", id)
+	}
+	v := form.Value
+	if v["from"][0] != `"Jane" <jane@example.com>` || v["to[0]"][0] != "<bob@example.com>" || v["cc[0]"][0] != "<carol@example.com>" {
+		t.Errorf("unexpected addresses: %v", v)
+	}
+	if v["html"][0] != "<p>see attached</p><img src=\"cid:logo.png\">" || v["text"][0] != "see attached" {
+		t.Errorf("unexpected bodies: %v", v)
+	}
+	if v["h:Reply-To"][0] != "<support@example.com>" || v["h:X-Campaign"][0] != "jan" {
+		t.Errorf("unexpected headers: %v", v)
+	}
+	for key, expected := range map[string][3]string{
+		"attachment": {"invoice.pdf", "application/pdf", "%PDF"},
+		"inline":     {"logo.png", "image/png", "PNG"},
+	} {
+		files := form.File[key]
+		if len(files) != 1 {
+			t.Fatalf("expected one %s, got %d", key, len(files))
+		}
+		f, err := files[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(f)
+		f.Close()
+		if files[0].Filename != expected[0] || files[0].Header.Get("Content-Type") != expected[1] || string(b) != expected[2] {
+			t.Errorf("unexpected %s: %s %s %q", key, files[0].Filename, files[0].Header.Get("Content-Type"), b)
+		}
+	}
+}
+
+func TestMailgunSendBatch(t *testing.T) {
+	mux := &sync.Mutex{}
+	var requests []*http.Request
+	mg, done := mailgunServer(t, func(r *http.Request) (int, string) {
+		mux.Lock()
+		defer mux.Unlock()
+		requests = append(requests, r)
+		return http.StatusOK, fmt.Sprintf(`{"id":"<%d@mg.example.com>"}`, len(requests))
+	})
+	defer done()
+	recipients := make([]email.BatchRecipient, 2500)
+	for i := range recipients {
+		recipients[i] = email.BatchRecipient{Address: fmt.Sprintf("user%d@example.com", i), Variables: map[string]any{"id": i}}
+	}
+	tracking := false
+	deliverAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ids, err := mg.SendBatch(context.Background(), &email.Email{From: "news@example.com", Subject: "Hi %recipient.id%", Text: "hello"}, recipients, &email.MailgunOptions{
+		Tags:         []string{"newsletter"},
+		DeliveryTime: deliverAt,
+		Tracking:     &tracking,
+		Variables:    map[string]string{"campaign": "jan"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || len(requests) != 3 {
+		t.Fatalf("expected 3 chunks, got %d ids, %d requests", len(ids), len(requests))
+	}
+	for i, expected := range []int{1000, 1000, 500} {
+		form := requests[i].MultipartForm.Value
+		var vars map[string]map[string]any
+		if err := json.Unmarshal([]byte(form["recipient-variables"][0]), &vars); err != nil {
+			t.Fatal(err)
+		}
+		if len(vars) != expected || form[fmt.Sprintf("to[%d]", expected-1)] == nil {
+			t.Errorf("chunk %d: expected %d recipients, got %d", i, expected, len(vars))
+		}
+		if form["o:tag"][0] != "newsletter" || form["o:tracking"][0] != "no" || form["v:campaign"][0] != "jan" {
+			t.Errorf("chunk %d: unexpected options: %v", i, form)
+		}
+		if form["o:deliverytime"][0] != "Tue, 02 Jan 2024 03:04:05 +0000" {
+			t.Errorf("chunk %d: unexpected delivery time: %s", i, form["o:deliverytime"][0])
+		}
+	}
+	if _, err := mg.SendBatch(context.Background(), &email.Email{From: "news@example.com", Subject: "Hi", Text: "hello"}, []email.BatchRecipient{{Address: "broken"}}, nil); err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	requests = nil
+	recipients[1200].Address = "broken"
+	if _, err := mg.SendBatch(context.Background(), &email.Email{From: "news@example.com", Subject: "Hi", Text: "hello"}, recipients[:1500], nil); err == nil || len(requests) != 0 {
+		t.Fatalf("expected validation error before sending, got %v after %d requests", err, len(requests))
+	}
+	recipients[1000].Address = "USER0@example.com"
+	if _, err := mg.SendBatch(context.Background(), &email.Email{From: "news@example.com", Subject: "Hi", Text: "hello"}, recipients[:1001], nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("expected the duplicate in the second chunk to be dropped, got %d requests", len(requests))
+	}
+}
+
+func TestMailgunAPIError(t *testing.T) {
+	tests := []struct {
+		code      int
+		body      string
+		message   string
+		retryable bool
+	}{
+		{code: http.StatusBadRequest, body: `{"message":"'to' parameter is not a valid address"}`, message: "'to' parameter is not a valid address"},
+		{code: http.StatusUnauthorized, body: "Forbidden", message: "Forbidden"},
+		{code: http.StatusTooManyRequests, body: `{"message":"slow down"}`, message: "slow down", retryable: true},
+		{code: http.StatusBadGateway, retryable: true},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.code), func(t *testing.T) {
+			mg, done := mailgunServer(t, func(r *http.Request) (int, string) {
+				return test.code, test.body
+			})
+			defer done()
+			_, err := mg.SendEmail(context.Background(), &email.Email{From: "a@example.com", To: []string{"b@example.com"}, Subject: "Hi", Text: "hello"})
+			var apiErr *email.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected api error, got %v", err)
+			}
+			if apiErr.StatusCode != test.code || apiErr.Message != test.message || apiErr.Retryable != test.retryable {
+				t.Fatalf("unexpected error: %+v", apiErr)
+			}
+			if email.IsRetryable(err) != test.retryable {
+				t.Fatalf("unexpected retryable")
+			}
+		})
+	}
+}
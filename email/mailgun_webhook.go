@@ -0,0 +1,144 @@
+package email
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/SimonSchneider/goslu/srvu"
+	"github.com/SimonSchneider/goslu/syncu"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventDelivered    EventType = "delivered"
+	EventFailed       EventType = "failed"
+	EventOpened       EventType = "opened"
+	EventClicked      EventType = "clicked"
+	EventComplained   EventType = "complained"
+	EventUnsubscribed EventType = "unsubscribed"
+	EventAccepted     EventType = "accepted"
+)
+
+type DeliveryStatus struct {
+	Code        int    `json:"code"`
+	Message     string `json:"message"`
+	Description string `json:"description"`
+}
+
+type Event struct {
+	ID        string    `json:"id"`
+	Type      EventType `json:"event"`
+	Timestamp time.Time `json:"-"`
+	Recipient string    `json:"recipient"`
+	// Severity is set for failed events, "permanent" means the address bounced and should not be used again.
+	Severity       string         `json:"severity"`
+	Reason         string         `json:"reason"`
+	DeliveryStatus DeliveryStatus `json:"delivery-status"`
+	Tags           []string       `json:"tags"`
+	UserVariables  map[string]any `json:"user-variables"`
+	// MessageID is the id returned by Mailgun.SendEmail without the surrounding angle brackets.
+	MessageID string `json:"-"`
+}
+
+func (e *Event) IsPermanentFailure() bool {
+	return e.Type == EventFailed && e.Severity == "permanent"
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	type plain Event
+	var raw struct {
+		plain
+		Timestamp float64 `json:"timestamp"`
+		Message   struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*e = Event(raw.plain)
+	sec, frac := math.Modf(raw.Timestamp)
+	e.Timestamp = time.Unix(int64(sec), int64(frac*1e9))
+	e.MessageID = raw.Message.Headers.MessageID
+	return nil
+}
+
+type webhookSignature struct {
+	Timestamp string `json:"timestamp"`
+	Token     string `json:"token"`
+	Signature string `json:"signature"`
+}
+
+type MailgunWebhook struct {
+	SigningKey string
+	// MaxAge rejects signatures older than this to limit replays, 0 disables the check.
+	MaxAge  time.Duration
+	OnEvent func(ctx context.Context, event Event) error
+}
+
+func NewMailgunWebhook(signingKey string, onEvent func(ctx context.Context, event Event) error) *MailgunWebhook {
+	return &MailgunWebhook{SigningKey: signingKey, MaxAge: 5 * time.Minute, OnEvent: onEvent}
+}
+
+// PublishTo returns an OnEvent callback that publishes every event to the broadcaster.
+func PublishTo(b *syncu.Broadcaster[Event]) func(ctx context.Context, event Event) error {
+	return func(ctx context.Context, event Event) error {
+		b.Publish(event)
+		return nil
+	}
+}
+
+func (h *MailgunWebhook) verify(sig webhookSignature, now time.Time) error {
+	mac := hmac.New(sha256.New, []byte(h.SigningKey))
+	mac.Write([]byte(sig.Timestamp + sig.Token))
+	expected, err := hex.DecodeString(sig.Signature)
+	if err != nil || !hmac.Equal(mac.Sum(nil), expected) {
+		return fmt.Errorf("invalid signature")
+	}
+	if h.MaxAge > 0 {
+		ts, err := strconv.ParseInt(sig.Timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+		if age := now.Sub(time.Unix(ts, 0)); age > h.MaxAge || age < -h.MaxAge {
+			return fmt.Errorf("signature timestamp outside of allowed window")
+		}
+	}
+	return nil
+}
+
+func (h *MailgunWebhook) serve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return srvu.ErrStr(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	var body struct {
+		Signature webhookSignature `json:"signature"`
+		Event     Event            `json:"event-data"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		return srvu.Err(http.StatusBadRequest, fmt.Errorf("decoding webhook: %w", err))
+	}
+	// Mailgun does not retry on 406, which is what we want for forged or replayed requests
+	if err := h.verify(body.Signature, time.Now()); err != nil {
+		return srvu.Err(http.StatusNotAcceptable, err)
+	}
+	if err := h.OnEvent(ctx, body.Event); err != nil {
+		return fmt.Errorf("handling event (%s): %w", body.Event.ID, err)
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (h *MailgunWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srvu.ErrHandlerFunc(h.serve).ServeHTTP(w, r)
+}
@@ -0,0 +1,63 @@
+package email_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/SimonSchneider/goslu/email"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedWebhook(key string, ts time.Time, eventData string) string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + "token"))
+	return fmt.Sprintf(`{"signature":{"timestamp":%q,"token":"token","signature":%q},"event-data":%s}`,
+		timestamp, hex.EncodeToString(mac.Sum(nil)), eventData)
+}
+
+func TestMailgunWebhook(t *testing.T) {
+	var events []email.Event
+	h := email.NewMailgunWebhook("key", func(ctx context.Context, event email.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	failed := `{"id":"ev1","event":"failed","timestamp":1521472262.5,"recipient":"bob@x.com","severity":"permanent",
+"delivery-status":{"code":550,"message":"no such user"},"message":{"headers":{"message-id":"123@mg.x.com"}}}`
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "valid", body: signedWebhook("key", time.Now(), failed), status: http.StatusOK},
+		{name: "wrong key", body: signedWebhook("other", time.Now(), failed), status: http.StatusNotAcceptable},
+		{name: "expired", body: signedWebhook("key", time.Now().Add(-time.Hour), failed), status: http.StatusNotAcceptable},
+		{name: "malformed", body: "{", status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body)))
+			if w.Code != test.status {
+				t.Fatalf("expected %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+		})
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	e := events[0]
+	if !e.IsPermanentFailure() || e.Recipient != "bob@x.com" || e.MessageID != "123@mg.x.com" || e.DeliveryStatus.Code != 550 {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if e.Timestamp.UnixMilli() != 1521472262500 {
+		t.Fatalf("unexpected timestamp: %s", e.Timestamp)
+	}
+}
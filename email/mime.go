@@ -0,0 +1,250 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/SimonSchneider/goslu/sid"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+)
+
+func NewMessageID(from string) (string, error) {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndexByte(addr.Address, '@'); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	id, err := sid.NewString(24)
+	if err != nil {
+		return "", fmt.Errorf("generating message id: %w", err)
+	}
+	return "<" + id + "@" + domain + ">", nil
+}
+
+func formatAddress(address string) string {
+	if addr, err := mail.ParseAddress(address); err == nil {
+		return addr.String()
+	}
+	return address
+}
+
+func formatAddressList(addresses []string) string {
+	formatted := make([]string, len(addresses))
+	for i, a := range addresses {
+		formatted[i] = formatAddress(a)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func (e *Email) header(messageID string) textproto.MIMEHeader {
+	h := textproto.MIMEHeader{}
+	h.Set("From", formatAddress(e.From))
+	h.Set("To", formatAddressList(e.To))
+	if len(e.Cc) > 0 {
+		h.Set("Cc", formatAddressList(e.Cc))
+	}
+	if e.ReplyTo != "" {
+		h.Set("Reply-To", formatAddress(e.ReplyTo))
+	}
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", e.Subject))
+	h.Set("Date", time.Now().Format(time.RFC1123Z))
+	h.Set("Message-Id", messageID)
+	h.Set("Mime-Version", "1.0")
+	for k, v := range e.Headers {
+		h.Set(k, mime.QEncoding.Encode("utf-8", v))
+	}
+	return h
+}
+
+func writeHeader(w io.Writer, h textproto.MIMEHeader) error {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			if _, err := fmt.Fprintf(w, "%s: %s\r\n", k, v); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// part is a node in the MIME tree, either a leaf with a body or a multipart container.
+type part struct {
+	header textproto.MIMEHeader
+	body   func(w io.Writer) error
+	parts  []part
+}
+
+func textPart(contentType, body string) part {
+	return part{
+		header: textproto.MIMEHeader{
+			"Content-Type":              {contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		},
+		body: func(w io.Writer) error {
+			qw := quotedprintable.NewWriter(w)
+			if _, err := io.WriteString(qw, body); err != nil {
+				return err
+			}
+			return qw.Close()
+		},
+	}
+}
+
+func attachmentPart(a Attachment, inline bool) part {
+	h := textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(a.contentType(), map[string]string{"name": a.Name})},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+	if inline {
+		h.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": a.Name}))
+		h.Set("Content-Id", "<"+a.Name+">")
+	} else {
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	}
+	return part{
+		header: h,
+		body: func(w io.Writer) error {
+			r, err := a.reader()
+			if err != nil {
+				return err
+			}
+			lw := &lineWrapper{w: w}
+			enc := base64.NewEncoder(base64.StdEncoding, lw)
+			if _, err := io.Copy(enc, r); err != nil {
+				return fmt.Errorf("encoding attachment (%s): %w", a.Name, err)
+			}
+			if err := enc.Close(); err != nil {
+				return err
+			}
+			return lw.Close()
+		},
+	}
+}
+
+func multipartOf(subtype string, parts ...part) part {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return part{header: textproto.MIMEHeader{"Content-Type": {"multipart/" + subtype}}, parts: parts}
+}
+
+func (e *Email) mimeTree() (part, error) {
+	var bodies []part
+	if e.Text != "" {
+		bodies = append(bodies, textPart("text/plain", e.Text))
+	}
+	if e.html() != "" {
+		bodies = append(bodies, textPart("text/html", e.html()))
+	}
+	if len(bodies) == 0 {
+		return part{}, fmt.Errorf("text or html body is required")
+	}
+	root := multipartOf("alternative", bodies...)
+	if len(e.Inline) > 0 {
+		related := []part{root}
+		for _, a := range e.Inline {
+			related = append(related, attachmentPart(a, true))
+		}
+		root = multipartOf("related", related...)
+	}
+	if len(e.Attachments) > 0 {
+		mixed := []part{root}
+		for _, a := range e.Attachments {
+			mixed = append(mixed, attachmentPart(a, false))
+		}
+		root = multipartOf("mixed", mixed...)
+	}
+	return root, nil
+}
+
+func writePart(w io.Writer, header textproto.MIMEHeader, p part) error {
+	for k, v := range p.header {
+		header[k] = v
+	}
+	if len(p.parts) == 0 {
+		if err := writeHeader(w, header); err != nil {
+			return err
+		}
+		return p.body(w)
+	}
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	header.Set("Content-Type", mime.FormatMediaType(header.Get("Content-Type"), map[string]string{"boundary": boundary}))
+	if err := writeHeader(w, header); err != nil {
+		return err
+	}
+	for _, child := range p.parts {
+		if _, err := io.WriteString(w, "\r\n--"+boundary+"\r\n"); err != nil {
+			return err
+		}
+		if err := writePart(w, textproto.MIMEHeader{}, child); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\r\n--"+boundary+"--\r\n")
+	return err
+}
+
+// WriteMIME writes the email as an RFC 5322 message. Bcc recipients are not included in the headers.
+func (e *Email) WriteMIME(w io.Writer, messageID string) error {
+	root, err := e.mimeTree()
+	if err != nil {
+		return err
+	}
+	return writePart(w, e.header(messageID), root)
+}
+
+func (e *Email) MIME(messageID string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := e.WriteMIME(buf, messageID); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type lineWrapper struct {
+	w   io.Writer
+	col int
+}
+
+func (l *lineWrapper) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		chunk := min(76-l.col, len(b))
+		if _, err := l.w.Write(b[:chunk]); err != nil {
+			return n, err
+		}
+		n += chunk
+		l.col += chunk
+		b = b[chunk:]
+		if l.col == 76 {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return n, err
+			}
+			l.col = 0
+		}
+	}
+	return n, nil
+}
+
+func (l *lineWrapper) Close() error {
+	if l.col > 0 {
+		_, err := io.WriteString(l.w, "\r\n")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package email_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/SimonSchneider/goslu/email"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestWriteMIME(t *testing.T) {
+	e := &email.Email{
+		From:    "Jane <jane@example.com>",
+		To:      []string{"bob@example.com"},
+		Bcc:     []string{"hidden@example.com"},
+		ReplyTo: "support@example.com",
+		Subject: "Invoice – October",
+		Text:    "Your invoice",
+		HTML:    `<p>Your invoice</p><img src="cid:logo.png">`,
+		Inline:  []email.Attachment{{Name: "logo.png", ContentType: "image/png", Content: bytes.NewReader([]byte{0x89, 'P', 'N', 'G'})}},
+		Attachments: []email.Attachment{
+			{Name: "invoice.pdf", ContentType: "application/pdf", Content: strings.NewReader(strings.Repeat("%PDF", 100))},
+		},
+		Headers: map[string]string{"X-Campaign": "invoices"},
+	}
+	b, err := e.MIME("<id@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != e.Subject {
+		t.Fatalf("unexpected subject: %s, %v", subject, err)
+	}
+	if msg.Header.Get("Bcc") != "" || bytes.Contains(b, []byte("hidden@example.com")) {
+		t.Fatal("bcc must not be part of the message")
+	}
+	if msg.Header.Get("X-Campaign") != "invoices" || msg.Header.Get("Reply-To") != "<support@example.com>" {
+		t.Fatalf("unexpected headers: %v", msg.Header)
+	}
+	types := map[string]string{}
+	collectParts(t, msg.Header.Get("Content-Type"), msg.Body, types)
+	expected := map[string]string{
+		"multipart/mixed":       "",
+		"multipart/related":     "",
+		"multipart/alternative": "",
+		"text/plain":            "Your invoice",
+		"text/html":             e.HTML,
+		"image/png":             "\x89PNG",
+		"application/pdf":       strings.Repeat("%PDF", 100),
+	}
+	for ct, body := range expected {
+		got, ok := types[ct]
+		if !ok {
+			t.Errorf("missing part %s", ct)
+		} else if got != body {
+			t.Errorf("unexpected body for %s: %q", ct, got)
+		}
+	}
+}
+
+func collectParts(t *testing.T, contentType string, body io.Reader, types map[string]string) {
+	t.Helper()
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mt, "multipart/") {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types[mt] = string(b)
+		return
+	}
+	types[mt] = ""
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pr io.Reader = p
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			pr = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		collectParts(t, p.Header.Get("Content-Type"), pr, types)
+	}
+}
+
+func TestWriteMIMEWithoutBody(t *testing.T) {
+	e := &email.Email{From: "jane@example.com", To: []string{"bob@example.com"}, Subject: "Hi"}
+	if _, err := e.MIME("<id@example.com>"); err == nil {
+		t.Error("expected error for an email without body")
+	}
+}
@@ -0,0 +1,22 @@
+package email
+
+import (
+	"context"
+	"github.com/SimonSchneider/goslu/srvu"
+	"time"
+)
+
+func WithLogger(logger srvu.Logger) Middleware {
+	return func(s Sender) Sender {
+		return SenderFunc(func(ctx context.Context, email *Email) (string, error) {
+			start := time.Now()
+			id, err := s.SendEmail(ctx, email)
+			if err != nil {
+				logger.Printf("email: failed to send %q to %v after %s: %s", email.Subject, email.To, time.Since(start), err)
+				return id, err
+			}
+			logger.Printf("email: sent %q to %v as %s in %s", email.Subject, email.To, id, time.Since(start))
+			return id, nil
+		})
+	}
+}
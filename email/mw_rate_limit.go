@@ -0,0 +1,68 @@
+package email
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type tokenBucket struct {
+	mux    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token and returns how long the caller has to wait before it may be used.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) cancel() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	d := b.reserve(time.Now())
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func WithRateLimit(perSecond float64, burst int) Middleware {
+	if perSecond <= 0 {
+		panic("perSecond must be greater than 0")
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return func(s Sender) Sender {
+		b := &tokenBucket{rate: perSecond, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+		return SenderFunc(func(ctx context.Context, email *Email) (string, error) {
+			if err := b.wait(ctx); err != nil {
+				return "", err
+			}
+			return s.SendEmail(ctx, email)
+		})
+	}
+}
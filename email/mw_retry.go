@@ -0,0 +1,80 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SimonSchneider/goslu/srvu"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Retryable      func(error) bool
+}
+
+// IsRetryable reports whether err is an *APIError marked as retryable or a srvu.StatusError with a 429 or 5xx code.
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable
+	}
+	var serr srvu.StatusError
+	if errors.As(err, &serr) {
+		return serr.Code == http.StatusTooManyRequests || serr.Code >= http.StatusInternalServerError
+	}
+	return false
+}
+
+func backoff(cfg RetryConfig, attempt int) time.Duration {
+	d := cfg.InitialBackoff << attempt
+	if d <= 0 || d > cfg.MaxBackoff {
+		d = cfg.MaxBackoff
+	}
+	// jitter in [d/2, d] so concurrent senders do not retry in lockstep
+	return d/2 + rand.N(d/2+1)
+}
+
+func WithRetry(cfg RetryConfig) Middleware {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 200 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 10 * time.Second
+	}
+	if cfg.Retryable == nil {
+		cfg.Retryable = IsRetryable
+	}
+	return func(s Sender) Sender {
+		return SenderFunc(func(ctx context.Context, email *Email) (string, error) {
+			var err error
+			for attempt := 0; attempt < cfg.MaxAttempts; attempt++ {
+				if attempt > 0 {
+					t := time.NewTimer(backoff(cfg, attempt-1))
+					select {
+					case <-ctx.Done():
+						t.Stop()
+						return "", fmt.Errorf("retrying after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+					case <-t.C:
+					}
+				}
+				var id string
+				id, err = s.SendEmail(ctx, email)
+				if err == nil {
+					return id, nil
+				}
+				if !cfg.Retryable(err) {
+					return "", err
+				}
+			}
+			return "", fmt.Errorf("giving up after %d attempts: %w", cfg.MaxAttempts, err)
+		})
+	}
+}
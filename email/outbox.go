@@ -0,0 +1,357 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/SimonSchneider/goslu/migrate"
+	"github.com/SimonSchneider/goslu/sid"
+	"github.com/SimonSchneider/goslu/srvu"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+//go:embed outbox
+var outboxMigrations embed.FS
+
+// OutboxMigrations returns the migrations creating the email_outbox table for the dialect, nil uses SQLite. Run them
+// with migrate using a separate Table so their versions do not mix with the migrations of the application.
+func OutboxMigrations(dialect migrate.Dialect) fs.FS {
+	dir := "outbox/default"
+	if dialect == migrate.MySQL {
+		// TEXT is limited to 64KB on MySQL, too small for the payload of emails with attachments
+		dir = "outbox/mysql"
+	}
+	sub, err := fs.Sub(outboxMigrations, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+type Outbox struct {
+	DB     *sql.DB
+	Sender Sender
+	// Dialect provides the placeholders of the queries, defaults to migrate.SQLite.
+	Dialect migrate.Dialect
+	Logger  srvu.Logger
+	// Retry configures how often and when failed emails are retried, all errors are retried by default.
+	Retry        RetryConfig
+	PollInterval time.Duration
+	BatchSize    int
+	// Lease is how long a claimed email is hidden from other dispatchers while it is being sent.
+	Lease time.Duration
+	// SendTimeout bounds a single send, in-flight sends are not cancelled when Run is stopped.
+	SendTimeout time.Duration
+	// RecordTimeout bounds recording the result of a send, it is not part of SendTimeout so the result is recorded
+	// even if the send timed out.
+	RecordTimeout time.Duration
+}
+
+func NewOutbox(db *sql.DB, sender Sender) *Outbox {
+	return &Outbox{DB: db, Sender: sender}
+}
+
+type outboxAttachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+type outboxEmail struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []outboxAttachment
+	Inline      []outboxAttachment
+	Headers     map[string]string
+}
+
+func toOutboxAttachments(attachments []Attachment) ([]outboxAttachment, error) {
+	res := make([]outboxAttachment, len(attachments))
+	for i, a := range attachments {
+		r, err := a.reader()
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("reading attachment (%s): %w", a.Name, err)
+		}
+		res[i] = outboxAttachment{Name: a.Name, ContentType: a.ContentType, Content: b}
+	}
+	return res, nil
+}
+
+func fromOutboxAttachments(attachments []outboxAttachment) []Attachment {
+	res := make([]Attachment, len(attachments))
+	for i, a := range attachments {
+		res[i] = Attachment{Name: a.Name, ContentType: a.ContentType, Content: bytes.NewReader(a.Content)}
+	}
+	return res
+}
+
+func encodeOutboxEmail(e *Email) ([]byte, error) {
+	attachments, err := toOutboxAttachments(e.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	inline, err := toOutboxAttachments(e.Inline)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(outboxEmail{
+		From: e.From, To: e.To, Cc: e.Cc, Bcc: e.Bcc, ReplyTo: e.ReplyTo,
+		Subject: e.Subject, Text: e.Text, HTML: e.html(),
+		Attachments: attachments, Inline: inline, Headers: e.Headers,
+	})
+}
+
+func decodeOutboxEmail(b []byte) (*Email, error) {
+	var o outboxEmail
+	if err := json.Unmarshal(b, &o); err != nil {
+		return nil, err
+	}
+	return &Email{
+		From: o.From, To: o.To, Cc: o.Cc, Bcc: o.Bcc, ReplyTo: o.ReplyTo,
+		Subject: o.Subject, Text: o.Text, HTML: o.HTML,
+		Attachments: fromOutboxAttachments(o.Attachments), Inline: fromOutboxAttachments(o.Inline), Headers: o.Headers,
+	}, nil
+}
+
+func (o *Outbox) dialect() migrate.Dialect {
+	if o.Dialect == nil {
+		return migrate.SQLite
+	}
+	return o.Dialect
+}
+
+// query replaces the ? placeholders of q with the placeholders of the Dialect.
+func (o *Outbox) query(q string) string {
+	b := &strings.Builder{}
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString(o.dialect().Placeholder(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Enqueue stores the email for sending, pass the transaction of the surrounding business logic as exec so that the
+// email is only sent if that transaction commits.
+func (o *Outbox) Enqueue(ctx context.Context, exec migrate.Execer, email *Email) (string, error) {
+	if err := email.Validate(); err != nil {
+		return "", fmt.Errorf("validating email: %w", err)
+	}
+	payload, err := encodeOutboxEmail(email)
+	if err != nil {
+		return "", fmt.Errorf("encoding email: %w", err)
+	}
+	id, err := sid.NewString(20)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UnixMilli()
+	if _, err := exec.ExecContext(ctx, o.query("INSERT INTO email_outbox (id, payload, status, attempts, next_attempt_at, created_at, updated_at) VALUES (?, ?, ?, 0, ?, ?, ?)"),
+		id, string(payload), OutboxPending, now, now, now); err != nil {
+		return "", fmt.Errorf("inserting into outbox: %w", err)
+	}
+	return id, nil
+}
+
+// SendEmail enqueues the email outside any transaction, the returned id is the outbox id.
+func (o *Outbox) SendEmail(ctx context.Context, email *Email) (string, error) {
+	return o.Enqueue(ctx, o.DB, email)
+}
+
+func (o *Outbox) withDefaults() *Outbox {
+	c := *o
+	if c.Retry.MaxAttempts <= 0 {
+		c.Retry.MaxAttempts = 8
+	}
+	if c.Retry.InitialBackoff <= 0 {
+		c.Retry.InitialBackoff = 30 * time.Second
+	}
+	if c.Retry.MaxBackoff <= 0 {
+		c.Retry.MaxBackoff = time.Hour
+	}
+	if c.Retry.Retryable == nil {
+		c.Retry.Retryable = func(error) bool { return true }
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = 5 * time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 10
+	}
+	if c.SendTimeout <= 0 {
+		c.SendTimeout = 30 * time.Second
+	}
+	if c.RecordTimeout <= 0 {
+		c.RecordTimeout = 5 * time.Second
+	}
+	if c.Lease <= 0 {
+		c.Lease = 2 * c.SendTimeout
+	}
+	return &c
+}
+
+// Start runs the dispatcher in the background until ctx is cancelled, the returned channel is closed when it stopped.
+func (o *Outbox) Start(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		o.Run(ctx)
+	}()
+	return done
+}
+
+// Run dispatches pending emails until ctx is cancelled.
+func (o *Outbox) Run(ctx context.Context) {
+	c := o.withDefaults()
+	logger := c.Logger
+	if logger == nil {
+		logger = srvu.GetLogger(ctx)
+	}
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			n, err := c.dispatch(ctx, logger)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Printf("email outbox: dispatching: %s", err)
+				}
+				break
+			}
+			if n < c.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type outboxRow struct {
+	id            string
+	payload       string
+	attempts      int
+	nextAttemptAt int64
+}
+
+func (o *Outbox) pending(ctx context.Context, now int64) ([]outboxRow, error) {
+	rows, err := o.DB.QueryContext(ctx, o.query("SELECT id, payload, attempts, next_attempt_at FROM email_outbox WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at ASC LIMIT ?"),
+		OutboxPending, now, o.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("querying pending emails: %w", err)
+	}
+	defer rows.Close()
+	var pending []outboxRow
+	for rows.Next() {
+		var r outboxRow
+		if err := rows.Scan(&r.id, &r.payload, &r.attempts, &r.nextAttemptAt); err != nil {
+			return nil, fmt.Errorf("scanning pending email: %w", err)
+		}
+		pending = append(pending, r)
+	}
+	return pending, rows.Err()
+}
+
+// claim leases the row by moving its next attempt forward, so that other dispatchers skip it while it is being sent
+// and it is picked up again if this dispatcher dies.
+func (o *Outbox) claim(ctx context.Context, r outboxRow, now int64) (bool, error) {
+	res, err := o.DB.ExecContext(ctx, o.query("UPDATE email_outbox SET next_attempt_at = ?, updated_at = ? WHERE id = ? AND status = ? AND next_attempt_at = ?"),
+		now+o.Lease.Milliseconds(), now, r.id, OutboxPending, r.nextAttemptAt)
+	if err != nil {
+		return false, fmt.Errorf("claiming email (%s): %w", r.id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("claiming email (%s): %w", r.id, err)
+	}
+	return n == 1, nil
+}
+
+func (o *Outbox) dispatch(ctx context.Context, logger srvu.Logger) (int, error) {
+	pending, err := o.pending(ctx, time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range pending {
+		if ctx.Err() != nil {
+			return len(pending), nil
+		}
+		claimed, err := o.claim(ctx, r, time.Now().UnixMilli())
+		if err != nil {
+			return 0, err
+		}
+		if !claimed {
+			continue
+		}
+		if err := o.send(ctx, logger, r); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
+
+func (o *Outbox) send(ctx context.Context, logger srvu.Logger, r outboxRow) error {
+	// the send is detached from ctx so that stopping the dispatcher does not abort an email half way through
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.SendTimeout)
+	defer cancel()
+	var providerID string
+	email, err := decodeOutboxEmail([]byte(r.payload))
+	if err != nil {
+		err = fmt.Errorf("decoding email: %w", err)
+	} else {
+		providerID, err = o.Sender.SendEmail(sendCtx, email)
+	}
+	// the result is recorded with its own deadline, sendCtx has expired if the send timed out
+	ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), o.RecordTimeout)
+	defer cancel()
+	now := time.Now()
+	if err == nil {
+		if _, err := o.DB.ExecContext(ctx, o.query("UPDATE email_outbox SET status = ?, attempts = ?, provider_id = ?, last_error = NULL, updated_at = ? WHERE id = ?"),
+			OutboxSent, r.attempts+1, providerID, now.UnixMilli(), r.id); err != nil {
+			return fmt.Errorf("marking email (%s) as sent: %w", r.id, err)
+		}
+		return nil
+	}
+	attempts := r.attempts + 1
+	status := OutboxPending
+	if attempts >= o.Retry.MaxAttempts || !o.Retry.Retryable(err) {
+		status = OutboxFailed
+		logger.Printf("email outbox: giving up on email (%s) after %d attempts: %s", r.id, attempts, err)
+	} else {
+		logger.Printf("email outbox: attempt %d for email (%s) failed: %s", attempts, r.id, err)
+	}
+	if _, err := o.DB.ExecContext(ctx, o.query("UPDATE email_outbox SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ? WHERE id = ?"),
+		status, attempts, now.Add(backoff(o.Retry, attempts-1)).UnixMilli(), err.Error(), now.UnixMilli(), r.id); err != nil {
+		return fmt.Errorf("recording failure of email (%s): %w", r.id, err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+-- migrate:up
+CREATE TABLE email_outbox (
+  id VARCHAR(255) PRIMARY KEY,
+  payload TEXT NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at BIGINT NOT NULL,
+  provider_id VARCHAR(255),
+  last_error TEXT,
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL
+);
+CREATE INDEX email_outbox_pending ON email_outbox (status, next_attempt_at);
+
+-- migrate:down
+DROP TABLE email_outbox;
@@ -0,0 +1,416 @@
+package email_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/SimonSchneider/goslu/email"
+	"github.com/SimonSchneider/goslu/migrate"
+	"github.com/SimonSchneider/goslu/srvu"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeOutboxRow struct {
+	id            string
+	payload       string
+	status        string
+	attempts      int64
+	nextAttemptAt int64
+	providerID    string
+	lastError     string
+}
+
+// fakeOutboxDB is a database/sql driver that keeps the email_outbox table in memory, it understands only the queries
+// of the Outbox.
+type fakeOutboxDB struct {
+	mux     sync.Mutex
+	rows    map[string]*fakeOutboxRow
+	queries []string
+}
+
+func newOutboxDB(t *testing.T) (*sql.DB, *fakeOutboxDB) {
+	f := &fakeOutboxDB{rows: map[string]*fakeOutboxRow{}}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+func (f *fakeOutboxDB) row(id string) fakeOutboxRow {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if r, ok := f.rows[id]; ok {
+		return *r
+	}
+	return fakeOutboxRow{}
+}
+
+// due makes the row pending now, skipping the backoff.
+func (f *fakeOutboxDB) due(id string) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.rows[id].nextAttemptAt = 0
+}
+
+func (f *fakeOutboxDB) Connect(context.Context) (driver.Conn, error) { return f, nil }
+func (f *fakeOutboxDB) Driver() driver.Driver                        { return f }
+func (f *fakeOutboxDB) Open(string) (driver.Conn, error)             { return f, nil }
+func (f *fakeOutboxDB) Prepare(string) (driver.Stmt, error)          { return nil, errors.New("not supported") }
+func (f *fakeOutboxDB) Close() error                                 { return nil }
+func (f *fakeOutboxDB) Begin() (driver.Tx, error)                    { return f, nil }
+func (f *fakeOutboxDB) Commit() error                                { return nil }
+func (f *fakeOutboxDB) Rollback() error                              { return nil }
+
+func (f *fakeOutboxDB) ExecContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.queries = append(f.queries, query)
+	args := make([]driver.Value, len(named))
+	for i, a := range named {
+		args[i] = a.Value
+	}
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO email_outbox"):
+		id := args[0].(string)
+		if _, ok := f.rows[id]; ok {
+			return nil, fmt.Errorf("duplicate id %s", id)
+		}
+		f.rows[id] = &fakeOutboxRow{id: id, payload: args[1].(string), status: args[2].(string), nextAttemptAt: args[3].(int64)}
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "UPDATE email_outbox SET next_attempt_at"):
+		r, ok := f.rows[args[2].(string)]
+		if !ok || r.status != args[3].(string) || r.nextAttemptAt != args[4].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		r.nextAttemptAt = args[0].(int64)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "UPDATE email_outbox SET status") && strings.Contains(query, "provider_id"):
+		r := f.rows[args[4].(string)]
+		r.status, r.attempts, r.providerID, r.lastError = args[0].(string), args[1].(int64), args[2].(string), ""
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "UPDATE email_outbox SET status"):
+		r := f.rows[args[5].(string)]
+		r.status, r.attempts, r.nextAttemptAt, r.lastError = args[0].(string), args[1].(int64), args[2].(int64), args[3].(string)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected exec: %s", query)
+}
+
+func (f *fakeOutboxDB) QueryContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.queries = append(f.queries, query)
+	if !strings.HasPrefix(query, "SELECT id, payload, attempts, next_attempt_at FROM email_outbox") {
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	status, now, limit := named[0].Value.(string), named[1].Value.(int64), int(named[2].Value.(int64))
+	var pending []*fakeOutboxRow
+	for _, r := range f.rows {
+		if r.status == status && r.nextAttemptAt <= now {
+			pending = append(pending, r)
+		}
+	}
+	slices.SortFunc(pending, func(a, b *fakeOutboxRow) int { return int(a.nextAttemptAt - b.nextAttemptAt) })
+	rows := &fakeRows{}
+	for _, r := range pending[:min(limit, len(pending))] {
+		rows.rows = append(rows.rows, []driver.Value{r.id, r.payload, r.attempts, r.nextAttemptAt})
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id", "payload", "attempts", "next_attempt_at"}
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func outboxEmail(to string) *email.Email {
+	return &email.Email{From: "noreply@example.com", To: []string{to}, Subject: "Hi", Text: "Hello"}
+}
+
+func startOutbox(t *testing.T, o *email.Outbox) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := o.Start(ctx)
+	stop := func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("outbox did not stop")
+		}
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func newTestOutbox(db *sql.DB, sender email.Sender) *email.Outbox {
+	o := email.NewOutbox(db, sender)
+	o.PollInterval = time.Millisecond
+	o.Logger = srvu.LoggerFunc(func(string, ...any) {})
+	return o
+}
+
+func TestOutboxEnqueue(t *testing.T) {
+	ctx := context.Background()
+	db, f := newOutboxDB(t)
+	o := newTestOutbox(db, email.NewFake())
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := o.Enqueue(ctx, tx, outboxEmail("bob@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	r := f.row(id)
+	if r.status != email.OutboxPending || r.attempts != 0 || r.nextAttemptAt > time.Now().UnixMilli() {
+		t.Errorf("unexpected row: %+v", r)
+	}
+	if _, err := o.Enqueue(ctx, db, &email.Email{From: "noreply@example.com", Subject: "Hi", Text: "Hello"}); err == nil {
+		t.Error("expected validation error")
+	}
+	if len(f.rows) != 1 {
+		t.Errorf("expected 1 row, got %d", len(f.rows))
+	}
+}
+
+func TestOutboxDialect(t *testing.T) {
+	db, f := newOutboxDB(t)
+	o := newTestOutbox(db, email.NewFake())
+	o.Dialect = migrate.Postgres
+	if _, err := o.SendEmail(context.Background(), outboxEmail("bob@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(f.queries[0], "VALUES ($1, $2, $3, 0, $4, $5, $6)") {
+		t.Errorf("unexpected query: %s", f.queries[0])
+	}
+}
+
+func TestOutboxSend(t *testing.T) {
+	db, f := newOutboxDB(t)
+	fake := email.NewFake()
+	o := newTestOutbox(db, fake)
+	id, err := o.SendEmail(context.Background(), outboxEmail("bob@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startOutbox(t, o)
+	waitFor(t, func() bool { return f.row(id).status == email.OutboxSent })
+	r := f.row(id)
+	sent, ok := fake.Last()
+	if !ok || sent.ID != r.providerID || sent.Email.Subject != "Hi" {
+		t.Errorf("unexpected sent email: %+v", sent)
+	}
+	if r.attempts != 1 || r.lastError != "" {
+		t.Errorf("unexpected row: %+v", r)
+	}
+}
+
+func TestOutboxClaim(t *testing.T) {
+	db, f := newOutboxDB(t)
+	fake := email.NewFake()
+	ids := make([]string, 20)
+	for i := range ids {
+		id, err := newTestOutbox(db, fake).SendEmail(context.Background(), outboxEmail(fmt.Sprintf("user%d@example.com", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	var stops []func()
+	for range 3 {
+		o := newTestOutbox(db, fake)
+		o.BatchSize = 5
+		stops = append(stops, startOutbox(t, o))
+	}
+	waitFor(t, func() bool {
+		return !slices.ContainsFunc(ids, func(id string) bool { return f.row(id).status != email.OutboxSent })
+	})
+	for _, stop := range stops {
+		stop()
+	}
+	if n := len(fake.Sent()); n != len(ids) {
+		t.Errorf("expected every email to be sent once, got %d sends", n)
+	}
+}
+
+func TestOutboxRetry(t *testing.T) {
+	db, f := newOutboxDB(t)
+	var calls atomic.Int32
+	o := newTestOutbox(db, email.SenderFunc(func(ctx context.Context, e *email.Email) (string, error) {
+		calls.Add(1)
+		return "", errors.New("boom")
+	}))
+	o.Retry = email.RetryConfig{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: 8 * time.Hour}
+	id, err := o.SendEmail(context.Background(), outboxEmail("bob@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startOutbox(t, o)
+	checkBackoff := func(attempts int64, d time.Duration) {
+		t.Helper()
+		start := time.Now()
+		waitFor(t, func() bool { return f.row(id).attempts == attempts })
+		r := f.row(id)
+		if r.status != email.OutboxPending || r.lastError != "boom" {
+			t.Errorf("unexpected row: %+v", r)
+		}
+		if r.nextAttemptAt < start.Add(d/2).UnixMilli() || r.nextAttemptAt > time.Now().Add(d).UnixMilli() {
+			t.Errorf("next attempt %s not within backoff %s", time.UnixMilli(r.nextAttemptAt).Sub(start), d)
+		}
+	}
+	checkBackoff(1, time.Hour)
+	f.due(id)
+	checkBackoff(2, 2*time.Hour)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+}
+
+func TestOutboxGiveUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		retryable func(error) bool
+		attempts  int64
+	}{
+		{name: "max attempts", attempts: 3},
+		{name: "not retryable", retryable: func(error) bool { return false }, attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, f := newOutboxDB(t)
+			var calls atomic.Int64
+			o := newTestOutbox(db, email.SenderFunc(func(ctx context.Context, e *email.Email) (string, error) {
+				calls.Add(1)
+				return "", errors.New("boom")
+			}))
+			o.Retry = email.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Retryable: tt.retryable}
+			id, err := o.SendEmail(context.Background(), outboxEmail("bob@example.com"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stop := startOutbox(t, o)
+			waitFor(t, func() bool { return f.row(id).status == email.OutboxFailed })
+			stop()
+			if r := f.row(id); r.attempts != tt.attempts || r.lastError != "boom" {
+				t.Errorf("unexpected row: %+v", r)
+			}
+			if n := calls.Load(); n != tt.attempts {
+				t.Errorf("expected %d attempts, got %d", tt.attempts, n)
+			}
+		})
+	}
+}
+
+func TestOutboxSendTimeout(t *testing.T) {
+	db, f := newOutboxDB(t)
+	o := newTestOutbox(db, email.SenderFunc(func(ctx context.Context, e *email.Email) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}))
+	o.SendTimeout = 10 * time.Millisecond
+	o.Retry = email.RetryConfig{MaxAttempts: 1}
+	id, err := o.SendEmail(context.Background(), outboxEmail("bob@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startOutbox(t, o)
+	waitFor(t, func() bool { return f.row(id).status == email.OutboxFailed })
+	if r := f.row(id); r.attempts != 1 || !strings.Contains(r.lastError, "deadline exceeded") {
+		t.Errorf("unexpected row: %+v", r)
+	}
+}
+
+func TestOutboxStop(t *testing.T) {
+	db, f := newOutboxDB(t)
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	o := newTestOutbox(db, email.SenderFunc(func(ctx context.Context, e *email.Email) (string, error) {
+		close(sending)
+		<-release
+		return "id", ctx.Err()
+	}))
+	id, err := o.SendEmail(context.Background(), outboxEmail("bob@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := o.Start(ctx)
+	<-sending
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("stopped before the in-flight send finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("outbox did not stop")
+	}
+	if r := f.row(id); r.status != email.OutboxSent || r.providerID != "id" {
+		t.Errorf("expected the in-flight send to be recorded, got %+v", r)
+	}
+}
+
+func TestOutboxMigrations(t *testing.T) {
+	for _, dialect := range []migrate.Dialect{nil, migrate.SQLite, migrate.Postgres, migrate.MySQL} {
+		names, err := fs.Glob(email.OutboxMigrations(dialect), "*.sql")
+		if err != nil || len(names) != 1 || names[0] != "20240101000000_create_email_outbox.sql" {
+			t.Fatalf("%v: unexpected migrations %v (%v)", dialect, names, err)
+		}
+		b, err := fs.ReadFile(email.OutboxMigrations(dialect), names[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "IF NOT EXISTS") {
+			t.Errorf("%v: migration must be plain DDL for every dialect", dialect)
+		}
+		if large := strings.Contains(string(b), "payload LONGTEXT"); large != (dialect == migrate.MySQL) {
+			t.Errorf("%v: unexpected payload type:\n%s", dialect, b)
+		}
+	}
+}
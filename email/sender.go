@@ -0,0 +1,53 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type Sender interface {
+	SendEmail(ctx context.Context, email *Email) (string, error)
+}
+
+type SenderFunc func(ctx context.Context, email *Email) (string, error)
+
+func (f SenderFunc) SendEmail(ctx context.Context, email *Email) (string, error) {
+	return f(ctx, email)
+}
+
+type Middleware func(Sender) Sender
+
+func With(s Sender, mws ...Middleware) Sender {
+	for i := len(mws) - 1; i >= 0; i-- {
+		s = mws[i](s)
+	}
+	return s
+}
+
+func Failover(senders ...Sender) Sender {
+	return SenderFunc(func(ctx context.Context, email *Email) (string, error) {
+		if len(senders) == 0 {
+			return "", fmt.Errorf("no senders configured")
+		}
+		errs := make([]error, 0, len(senders))
+		for i, s := range senders {
+			id, err := s.SendEmail(ctx, email)
+			if err == nil {
+				return id, nil
+			}
+			errs = append(errs, fmt.Errorf("sender [%d]: %w", i, err))
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return "", errors.Join(errs...)
+	})
+}
+
+var (
+	_ Sender = (*Fake)(nil)
+	_ Sender = (*Mailgun)(nil)
+	_ Sender = (*SMTP)(nil)
+	_ Sender = (*Outbox)(nil)
+)
@@ -0,0 +1,84 @@
+package email_test
+
+import (
+	"context"
+	"errors"
+	"github.com/SimonSchneider/goslu/email"
+	"github.com/SimonSchneider/goslu/srvu"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func failing(codes ...int) (email.Sender, *int) {
+	calls := 0
+	return email.SenderFunc(func(ctx context.Context, e *email.Email) (string, error) {
+		calls++
+		if calls <= len(codes) {
+			return "", srvu.ErrStr(codes[calls-1], "failed")
+		}
+		return "id", nil
+	}), &calls
+}
+
+func TestRetry(t *testing.T) {
+	retry := email.WithRetry(email.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	tests := []struct {
+		name  string
+		codes []int
+		calls int
+		fails bool
+	}{
+		{name: "success", calls: 1},
+		{name: "retries 5xx", codes: []int{http.StatusBadGateway, http.StatusServiceUnavailable}, calls: 3},
+		{name: "retries 429", codes: []int{http.StatusTooManyRequests}, calls: 2},
+		{name: "gives up", codes: []int{500, 500, 500, 500}, calls: 3, fails: true},
+		{name: "no retry on 4xx", codes: []int{http.StatusBadRequest}, calls: 1, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, calls := failing(test.codes...)
+			_, err := email.With(s, retry).SendEmail(context.Background(), &email.Email{})
+			if (err != nil) != test.fails {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *calls != test.calls {
+				t.Fatalf("expected %d calls, got %d", test.calls, *calls)
+			}
+		})
+	}
+}
+
+func TestFailover(t *testing.T) {
+	first, firstCalls := failing(http.StatusInternalServerError)
+	second, secondCalls := failing()
+	id, err := email.Failover(first, second).SendEmail(context.Background(), &email.Email{})
+	if err != nil || id != "id" {
+		t.Fatalf("unexpected result: %s, %v", id, err)
+	}
+	if *firstCalls != 1 || *secondCalls != 1 {
+		t.Fatalf("unexpected calls: %d, %d", *firstCalls, *secondCalls)
+	}
+	broken, _ := failing(http.StatusBadRequest)
+	if _, err := email.Failover(broken).SendEmail(context.Background(), &email.Email{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s, calls := failing()
+	limited := email.With(s, email.WithRateLimit(1, 2))
+	for i := 0; i < 2; i++ {
+		if _, err := limited.SendEmail(context.Background(), &email.Email{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limited.SendEmail(ctx, &email.Email{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if *calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", *calls)
+	}
+}
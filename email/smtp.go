@@ -0,0 +1,121 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"slices"
+)
+
+type SMTP struct {
+	Addr string
+	Auth smtp.Auth
+	// TLSConfig is used for STARTTLS if the server supports it, defaults to verifying the host of Addr.
+	TLSConfig *tls.Config
+	// Signer optionally signs every message, e.g. with a DKIMSigner.
+	Signer MessageSigner
+}
+
+func NewSMTP(addr string, auth smtp.Auth) *SMTP {
+	return &SMTP{Addr: addr, Auth: auth}
+}
+
+func envelopeAddress(address string) (string, error) {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("parsing address (%s): %w", address, err)
+	}
+	return addr.Address, nil
+}
+
+func (s *SMTP) SendEmail(ctx context.Context, email *Email) (string, error) {
+	if err := email.Validate(); err != nil {
+		return "", fmt.Errorf("validating email: %w", err)
+	}
+	email = email.Normalized()
+	from, err := envelopeAddress(email.From)
+	if err != nil {
+		return "", err
+	}
+	recipients := make([]string, 0, len(email.To)+len(email.Cc)+len(email.Bcc))
+	for _, r := range slices.Concat(email.To, email.Cc, email.Bcc) {
+		addr, err := envelopeAddress(r)
+		if err != nil {
+			return "", err
+		}
+		recipients = append(recipients, addr)
+	}
+	messageID, err := NewMessageID(email.From)
+	if err != nil {
+		return "", err
+	}
+	msg, err := email.MIME(messageID)
+	if err != nil {
+		return "", fmt.Errorf("building message: %w", err)
+	}
+	if s.Signer != nil {
+		if msg, err = s.Signer.Sign(msg); err != nil {
+			return "", err
+		}
+	}
+	if err := s.send(ctx, from, recipients, msg); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+func (s *SMTP) send(ctx context.Context, from string, recipients []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("parsing addr (%s): %w", s.Addr, err)
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("dialing smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("creating smtp client: %w", err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		cfg := s.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: host}
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return fmt.Errorf("starting tls: %w", err)
+		}
+	}
+	if s.Auth != nil {
+		if err := c.Auth(s.Auth); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("setting sender: %w", err)
+	}
+	for _, r := range recipients {
+		if err := c.Rcpt(r); err != nil {
+			return fmt.Errorf("adding recipient (%s): %w", r, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("starting data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("finishing data: %w", err)
+	}
+	return c.Quit()
+}
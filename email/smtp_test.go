@@ -0,0 +1,109 @@
+package email_test
+
+import (
+	"bufio"
+	"context"
+	"github.com/SimonSchneider/goslu/email"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type smtpSession struct {
+	from       string
+	recipients []string
+	data       string
+}
+
+// fakeSMTPServer accepts a single session without STARTTLS and AUTH and sends it on the returned channel.
+func fakeSMTPServer(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		s := smtpSession{}
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 localhost")
+			case "MAIL":
+				s.from = line[len("MAIL FROM:"):]
+				tp.PrintfLine("250 OK")
+			case "RCPT":
+				s.recipients = append(s.recipients, line[len("RCPT TO:"):])
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				b, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				s.data = string(b)
+				tp.PrintfLine("250 OK")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				sessions <- s
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return l.Addr().String(), sessions
+}
+
+func TestSMTPSendEmail(t *testing.T) {
+	addr, sessions := fakeSMTPServer(t)
+	id, err := email.NewSMTP(addr, nil).SendEmail(context.Background(), &email.Email{
+		From:        "Jane <jane@example.com>",
+		To:          []string{"Bob <bob@example.com>"},
+		Bcc:         []string{"hidden@example.com"},
+		ReplyTo:     "support@example.com",
+		Subject:     "Invoice",
+		Text:        "see attached",
+		HTML:        "<p>see attached</p>",
+		Attachments: []email.Attachment{{Name: "invoice.pdf", ContentType: "application/pdf", Content: strings.NewReader("%PDF")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := <-sessions
+	if s.from != "<jane@example.com>" {
+		t.Errorf("unexpected envelope sender: %s", s.from)
+	}
+	if !slices.Equal(s.recipients, []string{"<bob@example.com>", "<hidden@example.com>"}) {
+		t.Errorf("unexpected envelope recipients: %v", s.recipients)
+	}
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(s.data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Message-Id") != id || msg.Header.Get("Subject") != "Invoice" || msg.Header.Get("Reply-To") == "" {
+		t.Errorf("unexpected headers: %v", msg.Header)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Error("bcc must not be part of the message")
+	}
+	if !strings.HasPrefix(msg.Header.Get("Content-Type"), "multipart/mixed") {
+		t.Errorf("unexpected content type: %s", msg.Header.Get("Content-Type"))
+	}
+}
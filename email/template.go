@@ -0,0 +1,82 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/SimonSchneider/goslu/templ"
+	"html"
+	"io"
+	"strings"
+	texttemplate "text/template"
+)
+
+// TextTemplateProvider provides text/templates, a *text/template.Template implements it.
+type TextTemplateProvider interface {
+	Lookup(name string) *texttemplate.Template
+	ExecuteTemplate(w io.Writer, name string, data any) error
+}
+
+// TemplateRenderer renders emails from the templates "<name>.subject", "<name>.html" and "<name>.txt". The html body
+// is rendered from the html/templates of Templates, the subject and text body from the text/templates of
+// TextTemplates so they are not html escaped. Subject and text templates missing from TextTemplates, or all of them
+// if it is nil, are rendered from Templates instead. The subject is required and at least one of the bodies must
+// exist.
+type TemplateRenderer struct {
+	Templates     templ.TemplateProvider
+	TextTemplates TextTemplateProvider
+}
+
+func NewTemplateRenderer(templates templ.TemplateProvider, textTemplates TextTemplateProvider) *TemplateRenderer {
+	return &TemplateRenderer{Templates: templates, TextTemplates: textTemplates}
+}
+
+func (r *TemplateRenderer) execute(name string, data any) (string, bool, error) {
+	if r.Templates == nil || r.Templates.Lookup(name) == nil {
+		return "", false, nil
+	}
+	buf := &bytes.Buffer{}
+	if err := r.Templates.ExecuteTemplate(buf, name, data); err != nil {
+		return "", true, fmt.Errorf("executing template (%s): %w", name, err)
+	}
+	return buf.String(), true, nil
+}
+
+// executeText executes the text/template, or the html/template if TextTemplates does not define it. The escaping of
+// the html/template is reverted, which also decodes entities written literally in the template.
+func (r *TemplateRenderer) executeText(name string, data any) (string, bool, error) {
+	if r.TextTemplates == nil || r.TextTemplates.Lookup(name) == nil {
+		s, ok, err := r.execute(name, data)
+		return html.UnescapeString(s), ok, err
+	}
+	buf := &bytes.Buffer{}
+	if err := r.TextTemplates.ExecuteTemplate(buf, name, data); err != nil {
+		return "", true, fmt.Errorf("executing template (%s): %w", name, err)
+	}
+	return buf.String(), true, nil
+}
+
+func (r *TemplateRenderer) Render(name string, data any) (*Email, error) {
+	subject, ok, err := r.executeText(name+".subject", data)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("template (%s.subject) not found", name)
+	}
+	htmlBody, hasHTML, err := r.execute(name+".html", data)
+	if err != nil {
+		return nil, err
+	}
+	text, hasText, err := r.executeText(name+".txt", data)
+	if err != nil {
+		return nil, err
+	}
+	if !hasHTML && !hasText {
+		return nil, fmt.Errorf("neither template (%s.html) nor (%s.txt) found", name, name)
+	}
+	return &Email{
+		Subject: strings.Join(strings.Fields(subject), " "),
+		HTML:    htmlBody,
+		Text:    text,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package email_test
+
+import (
+	"github.com/SimonSchneider/goslu/email"
+	"github.com/SimonSchneider/goslu/templ"
+	"html/template"
+	"testing"
+	texttemplate "text/template"
+)
+
+func TestTemplateRenderer(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(`
+{{define "welcome.html"}}<p>Hi {{.Name}}</p>{{end}}
+`))
+	text := texttemplate.Must(texttemplate.New("").Parse(`
+{{define "welcome.subject"}}
+  Welcome {{.Name}} & friends
+{{end}}
+{{define "welcome.txt"}}Hi {{.Name}}, visit https://example.com/?token={{.Token}}&region=eu{{end}}
+{{define "nobody.subject"}}Hi{{end}}
+`))
+	r := email.NewTemplateRenderer(templ.TemplateProviderFunc(func() *template.Template { return tmpl }), text)
+	e, err := r.Render("welcome", map[string]string{"Name": "<Jane>", "Token": "a&b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "Welcome <Jane> & friends" {
+		t.Errorf("unexpected subject: %q", e.Subject)
+	}
+	if e.HTML != "<p>Hi &lt;Jane&gt;</p>" {
+		t.Errorf("unexpected html: %q", e.HTML)
+	}
+	if e.Text != "Hi <Jane>, visit https://example.com/?token=a&b&region=eu" {
+		t.Errorf("unexpected text: %q", e.Text)
+	}
+	if _, err := r.Render("nobody", nil); err == nil {
+		t.Error("expected error for missing bodies")
+	}
+	if _, err := r.Render("missing", nil); err == nil {
+		t.Error("expected error for missing subject")
+	}
+}
+
+func TestTemplateRendererHTMLOnly(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(`
+{{define "welcome.subject"}}Welcome {{.Name}} & friends{{end}}
+{{define "welcome.html"}}<p>Hi {{.Name}}</p>{{end}}
+{{define "welcome.txt"}}Hi {{.Name}}{{end}}
+`))
+	r := email.NewTemplateRenderer(templ.TemplateProviderFunc(func() *template.Template { return tmpl }), nil)
+	e, err := r.Render("welcome", map[string]string{"Name": "<Jane>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "Welcome <Jane> & friends" || e.Text != "Hi <Jane>" || e.HTML != "<p>Hi &lt;Jane&gt;</p>" {
+		t.Errorf("unexpected email: %+v", e)
+	}
+}
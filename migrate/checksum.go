@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// ChecksumPolicy decides how Migrate handles applied migrations whose up section changed since they were applied.
+type ChecksumPolicy int
+
+const (
+	ChecksumFail ChecksumPolicy = iota
+	ChecksumWarn
+	ChecksumIgnore
+)
+
+var ErrChecksumMismatch = errors.New("checksum of applied migration changed")
+
+// changedMigrations returns the applied migrations whose files no longer match the recorded checksum. Migrations
+// without a file are skipped, as are migrations applied before checksums were tracked unless untracked is set.
+func (m *Migrator) changedMigrations(dir fs.FS, names []string, applied []appliedVersion, untracked bool) ([]*migration, error) {
+	var changed []*migration
+	for _, a := range applied {
+		if (a.checksum == "" && !untracked) || !slices.Contains(names, a.version) {
+			continue
+		}
+		mig, err := m.load(dir, a.version)
+		if err != nil {
+			return nil, err
+		}
+		if mig.checksum != a.checksum {
+			changed = append(changed, mig)
+		}
+	}
+	return changed, nil
+}
+
+func (m *Migrator) verifyChecksums(ctx context.Context, dir fs.FS, names []string, applied []appliedVersion) error {
+	if m.Checksums == ChecksumIgnore {
+		return nil
+	}
+	changed, err := m.changedMigrations(dir, names, applied, false)
+	if err != nil || len(changed) == 0 {
+		return err
+	}
+	changedVersions := make([]string, len(changed))
+	for i, mig := range changed {
+		changedVersions[i] = mig.version
+	}
+	if m.Checksums == ChecksumWarn {
+		m.logger(ctx).Printf("migrate: %s: %s", ErrChecksumMismatch, strings.Join(changedVersions, ", "))
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(changedVersions, ", "))
+}
+
+// Repair accepts the current files of edited applied migrations by storing their checksums, it also records the
+// checksums of migrations applied before they were tracked.
+func Repair(ctx context.Context, dir fs.FS, db *sql.DB) error {
+	return (&Migrator{}).Repair(ctx, dir, db)
+}
+
+func (m *Migrator) Repair(ctx context.Context, dir fs.FS, db *sql.DB) error {
+	names, err := m.migrationNames(ctx, dir)
+	if err != nil {
+		return err
+	}
+	d := m.dialect()
+	update := fmt.Sprintf("UPDATE %s SET checksum = %s WHERE version = %s", m.table(), d.Placeholder(1), d.Placeholder(2))
+	return m.inTx(ctx, db, func(tx *sql.Tx, applied []appliedVersion) error {
+		migs, err := m.changedMigrations(dir, names, applied, true)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migs {
+			if _, err := tx.ExecContext(ctx, update, mig.checksum, mig.version); err != nil {
+				return fmt.Errorf("storing checksum (%s): %w", mig.version, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,41 @@
+// Command migrate creates migration files:
+//
+//	migrate -dir migrations create add_users
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/SimonSchneider/goslu/config"
+	"github.com/SimonSchneider/goslu/migrate"
+	"os"
+	"strings"
+)
+
+type Config struct {
+	Dir string `config:"u:directory of the migration files"`
+}
+
+func run(args []string) error {
+	cfg := &Config{Dir: "migrations"}
+	fset := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := config.ParseInto(cfg, fset, args, os.Getenv); err != nil {
+		return err
+	}
+	if fset.NArg() < 2 || fset.Arg(0) != "create" {
+		return fmt.Errorf("usage: migrate [-dir DIR] create NAME")
+	}
+	path, err := migrate.Create(cfg.Dir, strings.Join(fset.Args()[1:], "_"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,48 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// versionPattern matches migration files, they start with a numeric version such as a YYYYMMDDHHMMSS timestamp.
+// Other files in the dir, e.g. a README.md or schema.sql, are ignored.
+var versionPattern = regexp.MustCompile(`^[0-9]+[0-9A-Za-z_-]*\.sql$`)
+
+func isMigrationFile(name string) bool {
+	return versionPattern.MatchString(name)
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+const skeleton = startUp + "\n\n" + startDown + "\n"
+
+// Create writes an empty migration named YYYYMMDDHHMMSS_name.sql to dir and returns its path. Spaces and dashes in
+// the name are replaced by underscores.
+func Create(dir string, name string) (string, error) {
+	return create(dir, name, time.Now())
+}
+
+func create(dir string, name string, now time.Time) (string, error) {
+	name = strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(name)))
+	if !namePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid migration name '%s', use letters, digits and underscores", name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating dir: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.sql", now.UTC().Format("20060102150405"), name))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("creating migration: %w", err)
+	}
+	if _, err := f.WriteString(skeleton); err != nil {
+		f.Close()
+		return "", fmt.Errorf("writing migration: %w", err)
+	}
+	return path, f.Close()
+}
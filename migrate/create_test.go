@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"github.com/SimonSchneider/goslu/srvu"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	now := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+	path, err := create(dir, "Add users-table", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "20240305140709_add_users_table.sql" {
+		t.Errorf("unexpected file name: %s", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "-- migrate:up\n\n-- migrate:down\n" {
+		t.Errorf("unexpected content: %q", b)
+	}
+	if _, err := create(dir, "add users table", now); err == nil {
+		t.Error("expected error when the migration exists")
+	}
+	if _, err := create(dir, "drop;users", now); err == nil {
+		t.Error("expected error for invalid name")
+	}
+}
+
+func TestIsMigrationFile(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"1.sql":                           true,
+		"20240305140709_add_users.sql":    true,
+		"0005a_x.sql":                     true,
+		"README.md":                       false,
+		"schema.sql":                      false,
+		"20240305140709_add_users.sql.bk": false,
+	} {
+		if isMigrationFile(name) != expected {
+			t.Errorf("%s: expected %t", name, expected)
+		}
+	}
+}
+
+func TestMigrationNames(t *testing.T) {
+	dir := fstest.MapFS{
+		"1_init.sql":             &fstest.MapFile{},
+		"20240101_add.users.sql": &fstest.MapFile{},
+		"0001_init.up.sql":       &fstest.MapFile{},
+		"README.md":              &fstest.MapFile{},
+		"schema.sql":             &fstest.MapFile{},
+	}
+	var logged []string
+	m := &Migrator{Logger: srvu.LoggerFunc(func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})}
+	names, err := m.migrationNames(context.Background(), dir)
+	if err != nil || len(names) != 1 || names[0] != "1_init.sql" {
+		t.Errorf("unexpected files %v (%v)", names, err)
+	}
+	if len(logged) != 2 || !strings.Contains(logged[0], "0001_init.up.sql") || !strings.Contains(logged[1], "20240101_add.users.sql") {
+		t.Errorf("expected the mistyped migrations to be logged, got %q", logged)
+	}
+}
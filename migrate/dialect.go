@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect covers the differences between databases that matter for running migrations.
+type Dialect interface {
+	// Placeholder returns the bind parameter for the n:th (1-based) argument of a query.
+	Placeholder(n int) string
+	// CreateTable returns the DDL creating the migrations table if it does not exist.
+	CreateTable(table string) string
+	// TransactionalDDL reports whether schema changes can be rolled back as part of a transaction.
+	TransactionalDDL() bool
+	// DumpSchema returns the schema of the current database as deterministic SQL.
+	DumpSchema(ctx context.Context, q Queryer) (string, error)
+	// TableExists reports whether the, optionally schema qualified, table exists.
+	TableExists(ctx context.Context, q Queryer, table string) (bool, error)
+}
+
+// splitTable splits a schema qualified table name, the schema is empty for unqualified names.
+func splitTable(table string) (string, string) {
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		return table[:i], table[i+1:]
+	}
+	return "", table
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Placeholder(int) string { return "?" }
+
+func (sqliteDialect) CreateTable(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  version VARCHAR(255) PRIMARY KEY,\n  checksum VARCHAR(64),\n  applied_at BIGINT\n)", table)
+}
+
+func (sqliteDialect) TransactionalDDL() bool { return true }
+
+func (sqliteDialect) DumpSchema(ctx context.Context, q Queryer) (string, error) {
+	return dumpSQLite(ctx, q)
+}
+
+func (sqliteDialect) TableExists(ctx context.Context, q Queryer, table string) (bool, error) {
+	_, name := splitTable(table)
+	return queryExists(ctx, q, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) CreateTable(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  version VARCHAR(255) PRIMARY KEY,\n  checksum VARCHAR(64),\n  applied_at BIGINT\n)", table)
+}
+
+func (postgresDialect) TransactionalDDL() bool { return true }
+
+// DumpSchema covers the tables, constraints and indexes of the current schema.
+func (postgresDialect) DumpSchema(ctx context.Context, q Queryer) (string, error) {
+	return dumpPostgres(ctx, q)
+}
+
+// TableExists resolves unqualified names through the search_path like the queries of the migrator.
+func (postgresDialect) TableExists(ctx context.Context, q Queryer, table string) (bool, error) {
+	return queryExists(ctx, q, "SELECT CASE WHEN to_regclass($1) IS NULL THEN 0 ELSE 1 END", table)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Placeholder(int) string { return "?" }
+
+func (mysqlDialect) CreateTable(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  version VARCHAR(255) NOT NULL PRIMARY KEY,\n  checksum VARCHAR(64),\n  applied_at BIGINT\n)", table)
+}
+
+// TransactionalDDL is false as MySQL implicitly commits the open transaction on every DDL statement.
+func (mysqlDialect) TransactionalDDL() bool { return false }
+
+// DumpSchema covers the tables, primary keys, foreign keys and indexes of the current database.
+func (mysqlDialect) DumpSchema(ctx context.Context, q Queryer) (string, error) {
+	return dumpMySQL(ctx, q)
+}
+
+func (mysqlDialect) TableExists(ctx context.Context, q Queryer, table string) (bool, error) {
+	schema, name := splitTable(table)
+	if schema == "" {
+		return queryExists(ctx, q, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", name)
+	}
+	return queryExists(ctx, q, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", schema, name)
+}
+
+func queryExists(ctx context.Context, q Queryer, query string, args ...any) (bool, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	var n int64
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return false, err
+		}
+	}
+	return n > 0, rows.Err()
+}
+
+var (
+	SQLite   Dialect = sqliteDialect{}
+	Postgres Dialect = postgresDialect{}
+	MySQL    Dialect = mysqlDialect{}
+)
@@ -24,7 +24,86 @@ func OpenFakeDB() (*sql.DB, *FakeDriver, error) {
 
 type FakeDriver struct {
 	mux        *sync.Mutex
-	statements []FakeStmt
+	statements []*FakeStmt
+	versions   []FakeVersion
+	responses  []fakeResponse
+	inTx       bool
+}
+
+type fakeResponse struct {
+	prefix  string
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// FakeVersion is a row of the migrations table, empty fields are returned as NULL.
+type FakeVersion struct {
+	Version   string
+	Checksum  string
+	AppliedAt int64
+}
+
+// Reset clears the recorded statements and sets the versions returned by queries.
+func (f *FakeDriver) Reset(versions ...string) {
+	applied := make([]FakeVersion, len(versions))
+	for i, v := range versions {
+		applied[i] = FakeVersion{Version: v}
+	}
+	f.ResetApplied(applied...)
+}
+
+// ResetApplied clears the recorded statements and sets the rows returned by queries.
+func (f *FakeDriver) ResetApplied(applied ...FakeVersion) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.statements = nil
+	f.versions = applied
+	f.responses = nil
+}
+
+// InTx reports whether the first executed statement with the query ran in a transaction.
+func (f *FakeDriver) InTx(query string) bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for _, stmt := range f.statements {
+		if stmt.executed && stmt.query == query {
+			return stmt.inTx
+		}
+	}
+	panic("not executed: " + query)
+}
+
+// Respond makes queries starting with prefix return a single row with the values.
+func (f *FakeDriver) Respond(prefix string, columns []string, values ...driver.Value) {
+	f.RespondRows(prefix, columns, values)
+}
+
+// RespondRows makes queries starting with prefix return the rows.
+func (f *FakeDriver) RespondRows(prefix string, columns []string, rows ...[]driver.Value) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.responses = append(f.responses, fakeResponse{prefix: prefix, columns: columns, rows: rows})
+}
+
+// Fail makes statements starting with prefix fail with err.
+func (f *FakeDriver) Fail(prefix string, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.responses = append(f.responses, fakeResponse{prefix: prefix, err: err})
+}
+
+// Executed returns the executed queries.
+func (f *FakeDriver) Executed() []string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	queries := make([]string, 0, len(f.statements))
+	for _, stmt := range f.statements {
+		if stmt.executed {
+			queries = append(queries, stmt.query)
+		}
+	}
+	return queries
 }
 
 func (f *FakeDriver) String() string {
@@ -37,18 +116,37 @@ func (f *FakeDriver) String() string {
 }
 
 func (f *FakeDriver) Commit() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.inTx = false
 	return nil
 }
 
 func (f *FakeDriver) Rollback() error {
-	return nil
+	return f.Commit()
 }
 
 func (f *FakeDriver) Prepare(query string) (driver.Stmt, error) {
 	f.mux.Lock()
 	defer f.mux.Unlock()
-	f.statements = append(f.statements, FakeStmt{query: query})
-	return &f.statements[len(f.statements)-1], nil
+	stmt := &FakeStmt{query: query, inTx: f.inTx, columns: []string{"version", "checksum", "applied_at"}}
+	for _, v := range f.versions {
+		row := []driver.Value{v.Version, nil, nil}
+		if v.Checksum != "" {
+			row[1] = v.Checksum
+		}
+		if v.AppliedAt != 0 {
+			row[2] = v.AppliedAt
+		}
+		stmt.rows = append(stmt.rows, row)
+	}
+	for _, r := range f.responses {
+		if strings.HasPrefix(query, r.prefix) {
+			stmt.columns, stmt.rows, stmt.err = r.columns, r.rows, r.err
+		}
+	}
+	f.statements = append(f.statements, stmt)
+	return stmt, nil
 }
 
 func (f *FakeDriver) Close() error {
@@ -56,6 +154,9 @@ func (f *FakeDriver) Close() error {
 }
 
 func (f *FakeDriver) Begin() (driver.Tx, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.inTx = true
 	return f, nil
 }
 
@@ -77,8 +178,12 @@ func (f *FakeDriver) Driver() driver.Driver {
 
 type FakeStmt struct {
 	executed bool
+	inTx     bool
 	query    string
 	args     []driver.Value
+	columns  []string
+	rows     [][]driver.Value
+	err      error
 }
 
 func (f *FakeStmt) String() string {
@@ -90,6 +195,9 @@ func (f *FakeStmt) Close() error {
 }
 
 func (f *FakeStmt) NumInput() int {
+	if strings.Contains(f.query, "$") {
+		return -1
+	}
 	return strings.Count(f.query, "?")
 }
 
@@ -99,6 +207,9 @@ func (f *FakeStmt) Exec(args []driver.Value) (driver.Result, error) {
 	}
 	f.executed = true
 	f.args = args
+	if f.err != nil {
+		return nil, f.err
+	}
 	return &FakeResult{}, nil
 }
 
@@ -108,7 +219,10 @@ func (f *FakeStmt) Query(args []driver.Value) (driver.Rows, error) {
 	}
 	f.executed = true
 	f.args = args
-	return FakeRows{}, nil
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &FakeRows{columns: f.columns, rows: f.rows}, nil
 }
 
 type FakeResult struct {
@@ -123,23 +237,24 @@ func (f *FakeResult) RowsAffected() (int64, error) {
 }
 
 type FakeRows struct {
-	idx  int
-	vals []string
+	idx     int
+	columns []string
+	rows    [][]driver.Value
 }
 
-func (f FakeRows) Columns() []string {
-	return []string{"version"}
+func (f *FakeRows) Columns() []string {
+	return f.columns
 }
 
-func (f FakeRows) Close() error {
+func (f *FakeRows) Close() error {
 	return nil
 }
 
-func (f FakeRows) Next(dest []driver.Value) error {
-	if f.idx >= len(f.vals) {
+func (f *FakeRows) Next(dest []driver.Value) error {
+	if f.idx >= len(f.rows) {
 		return io.EOF
 	}
-	dest[0] = f.vals[f.idx]
+	copy(dest, f.rows[f.idx])
 	f.idx++
 	return nil
 }
@@ -0,0 +1,58 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"slices"
+)
+
+// MigrationFunc is a migration implemented in Go, e.g. to backfill computed values. It runs in the transaction of
+// the migration.
+type MigrationFunc func(ctx context.Context, tx Tx) error
+
+// GoMigration is recorded in the migrations table like a file, Down is optional but without it the migration cannot
+// be rolled back. Go migrations have no checksum.
+type GoMigration struct {
+	Up   MigrationFunc
+	Down MigrationFunc
+}
+
+// Register adds a Go migration that runs in order with the files of the dir.
+func (m *Migrator) Register(version string, up, down MigrationFunc) *Migrator {
+	if m.GoMigrations == nil {
+		m.GoMigrations = make(map[string]GoMigration)
+	}
+	m.GoMigrations[version] = GoMigration{Up: up, Down: down}
+	return m
+}
+
+// migrationNames returns the versions of the files in dir and the Go migrations in order.
+func (m *Migrator) migrationNames(ctx context.Context, dir fs.FS) ([]string, error) {
+	names, suspicious, err := migrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range suspicious {
+		m.logger(ctx).Printf("migrate: ignoring '%s', migration files must start with a numeric version and contain only letters, digits, underscores and dashes", name)
+	}
+	for version := range m.GoMigrations {
+		if slices.Contains(names, version) {
+			return nil, fmt.Errorf("version '%s' is both a file and a Go migration", version)
+		}
+		names = append(names, version)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (m *Migrator) load(dir fs.FS, name string) (*migration, error) {
+	if g, ok := m.GoMigrations[name]; ok {
+		return &migration{version: name, upFunc: g.Up, downFunc: g.Down}, nil
+	}
+	mig, err := readFile(dir, name)
+	if err != nil {
+		return nil, &MigrationError{File: name, Err: fmt.Errorf("reading file: %w", err)}
+	}
+	return mig, nil
+}
@@ -0,0 +1,165 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/SimonSchneider/goslu/sid"
+	"hash/fnv"
+	"time"
+)
+
+// Locker ensures only one process migrates a database at a time. The lock is held on a single connection, which is
+// also used to run the migrations.
+type Locker interface {
+	// TryLock acquires the lock if it is free and reports whether it did.
+	TryLock(ctx context.Context, conn *sql.Conn) (bool, error)
+	Unlock(ctx context.Context, conn *sql.Conn) error
+}
+
+var ErrLocked = errors.New("migrations are locked by another process")
+
+const defaultLockPollInterval = time.Second
+
+// lockKey derives a lock key from the name, e.g. the migrations table, so unrelated migrators do not block each other.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func queryBool(ctx context.Context, conn *sql.Conn, query string, args ...any) (bool, error) {
+	var ok sql.NullBool
+	if err := conn.QueryRowContext(ctx, query, args...).Scan(&ok); err != nil {
+		return false, err
+	}
+	return ok.Valid && ok.Bool, nil
+}
+
+type postgresLock struct {
+	key int64
+}
+
+// PostgresLock locks with a session level advisory lock keyed by name.
+func PostgresLock(name string) Locker {
+	return &postgresLock{key: lockKey(name)}
+}
+
+func (l *postgresLock) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	return queryBool(ctx, conn, "SELECT pg_try_advisory_lock($1)", l.key)
+}
+
+func (l *postgresLock) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+	return err
+}
+
+type mysqlLock struct {
+	name string
+}
+
+// MySQLLock locks with a named lock using GET_LOCK.
+func MySQLLock(name string) Locker {
+	return &mysqlLock{name: name}
+}
+
+func (l *mysqlLock) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	return queryBool(ctx, conn, "SELECT GET_LOCK(?, 0)", l.name)
+}
+
+func (l *mysqlLock) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.name)
+	return err
+}
+
+// TableLock locks by inserting a row into Table, for databases without advisory locks such as SQLite. A lock that is
+// not released, e.g. because the process crashed, is taken over once its Lease expires so the lease has to be longer
+// than the migrations take. Create it with NewTableLock, a nil Dialect uses SQLite.
+type TableLock struct {
+	Table   string
+	Dialect Dialect
+	Lease   time.Duration
+	owner   string
+}
+
+func NewTableLock(table string, dialect Dialect, lease time.Duration) *TableLock {
+	return &TableLock{Table: table, Dialect: dialect, Lease: lease, owner: sid.MustNewString(32)}
+}
+
+func (l *TableLock) dialect() Dialect {
+	if l.Dialect == nil {
+		return SQLite
+	}
+	return l.Dialect
+}
+
+func (l *TableLock) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	if l.owner == "" {
+		return false, errors.New("table lock without owner, create it with NewTableLock")
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  id INTEGER PRIMARY KEY,\n  owner VARCHAR(64) NOT NULL,\n  expires_at BIGINT NOT NULL\n)", l.Table)); err != nil {
+		return false, fmt.Errorf("creating lock table: %w", err)
+	}
+	d := l.dialect()
+	now := time.Now()
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at < %s", l.Table, d.Placeholder(1)), now.UnixMilli()); err != nil {
+		return false, fmt.Errorf("removing expired lock: %w", err)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (id, owner, expires_at) VALUES (1, %s, %s)", l.Table, d.Placeholder(1), d.Placeholder(2))
+	if _, err := conn.ExecContext(ctx, insert, l.owner, now.Add(l.Lease).UnixMilli()); err != nil {
+		// the insert violates the primary key while another process holds the lock, any other failure is an error
+		held, qErr := queryBool(ctx, conn, fmt.Sprintf("SELECT COUNT(*) > 0 FROM %s WHERE id = 1", l.Table))
+		if qErr != nil || !held {
+			return false, fmt.Errorf("inserting lock: %w", err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func (l *TableLock) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND owner = %s", l.Table, l.dialect().Placeholder(1)), l.owner)
+	return err
+}
+
+// withConn runs f on a single connection while holding the lock of the Migrator, if it has a Locker.
+func (m *Migrator) withConn(ctx context.Context, db *sql.DB, f func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("getting connection: %w", err)
+	}
+	defer conn.Close()
+	if m.Locker == nil {
+		return f(conn)
+	}
+	interval := m.LockPollInterval
+	if interval <= 0 {
+		interval = defaultLockPollInterval
+	}
+	for {
+		ok, err := m.Locker.TryLock(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("acquiring lock: %w", err)
+		}
+		if ok {
+			break
+		}
+		if m.SkipIfLocked {
+			return ErrLocked
+		}
+		m.logger(ctx).Printf("migrate: waiting for lock")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	defer func() {
+		// the lock must be released even if ctx is cancelled
+		if err := m.Locker.Unlock(context.WithoutCancel(ctx), conn); err != nil {
+			m.logger(ctx).Printf("migrate: releasing lock: %s", err)
+		}
+	}()
+	return f(conn)
+}
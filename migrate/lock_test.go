@@ -0,0 +1,103 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"github.com/SimonSchneider/goslu/migrate"
+	"testing"
+	"time"
+)
+
+func TestPostgresLock(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &migrate.Migrator{Dialect: migrate.Postgres, Locker: migrate.PostgresLock("schema_migrations")}
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	drvr.Respond("SELECT pg_try_advisory_lock", []string{"locked"}, true)
+	if err := m.Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	executed := drvr.Executed()
+	if executed[0] != "SELECT pg_try_advisory_lock($1)" || executed[len(executed)-1] != "SELECT pg_advisory_unlock($1)" {
+		t.Fatalf("expected migrations to run while holding the lock:\n%s", drvr)
+	}
+
+	drvr.Reset()
+	drvr.Respond("SELECT pg_try_advisory_lock", []string{"locked"}, false)
+	m.SkipIfLocked = true
+	if err := m.Migrate(context.Background(), rollbackDir, db); !errors.Is(err, migrate.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if executed := drvr.Executed(); len(executed) != 1 {
+		t.Fatalf("expected only the lock attempt:\n%s", drvr)
+	}
+
+	m.SkipIfLocked = false
+	m.LockPollInterval = time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Migrate(ctx, rollbackDir, db); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to wait for the lock until the deadline, got %v", err)
+	}
+	if executed := drvr.Executed(); len(executed) < 2 {
+		t.Fatalf("expected several lock attempts:\n%s", drvr)
+	}
+}
+
+func TestMySQLLock(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &migrate.Migrator{Dialect: migrate.MySQL, Locker: migrate.MySQLLock("app"), SkipIfLocked: true}
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	// GET_LOCK returns NULL on errors
+	drvr.Respond("SELECT GET_LOCK", []string{"locked"}, nil)
+	if err := m.Migrate(context.Background(), rollbackDir, db); !errors.Is(err, migrate.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	drvr.Respond("SELECT GET_LOCK", []string{"locked"}, int64(1))
+	if err := m.Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	if executed := drvr.Executed(); executed[len(executed)-1] != "SELECT RELEASE_LOCK(?)" {
+		t.Fatalf("expected the lock to be released:\n%s", drvr)
+	}
+}
+
+func TestTableLock(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a nil dialect defaults to SQLite
+	m := &migrate.Migrator{Locker: migrate.NewTableLock("migrations_lock", nil, time.Minute), SkipIfLocked: true}
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	if err := m.Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	executed := drvr.Executed()
+	if executed[2] != "INSERT INTO migrations_lock (id, owner, expires_at) VALUES (1, ?, ?)" ||
+		executed[len(executed)-1] != "DELETE FROM migrations_lock WHERE id = 1 AND owner = ?" {
+		t.Fatalf("expected migrations to run while holding the lock:\n%s", drvr)
+	}
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	drvr.Fail("INSERT INTO migrations_lock", errors.New("UNIQUE constraint failed"))
+	drvr.Respond("SELECT COUNT(*) > 0 FROM migrations_lock", []string{"held"}, true)
+	if err := m.Migrate(context.Background(), rollbackDir, db); !errors.Is(err, migrate.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	drvr.Fail("INSERT INTO migrations_lock", errors.New("database is read only"))
+	drvr.Respond("SELECT COUNT(*) > 0 FROM migrations_lock", []string{"held"}, false)
+	if err := m.Migrate(context.Background(), rollbackDir, db); err == nil || errors.Is(err, migrate.ErrLocked) {
+		t.Fatalf("expected the insert error, got %v", err)
+	}
+	m.Locker = &migrate.TableLock{Table: "migrations_lock"}
+	if err := m.Migrate(context.Background(), rollbackDir, db); err == nil {
+		t.Fatal("expected error for a table lock without owner")
+	}
+}
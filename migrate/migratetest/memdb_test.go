@@ -0,0 +1,113 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// memDB is a database/sql driver that only understands the statements of the sqlite dialect of migrate and CREATE
+// and DROP TABLE, just enough to track the schema.
+type memDB struct {
+	mux      sync.Mutex
+	tables   map[string]string
+	versions []string
+}
+
+func (d *memDB) Connect(context.Context) (driver.Conn, error) { return d, nil }
+func (d *memDB) Driver() driver.Driver                        { return nil }
+func (d *memDB) Prepare(query string) (driver.Stmt, error)    { return &memStmt{db: d, query: query}, nil }
+func (d *memDB) Close() error                                 { return nil }
+func (d *memDB) Begin() (driver.Tx, error)                    { return d, nil }
+func (d *memDB) Commit() error                                { return nil }
+func (d *memDB) Rollback() error                              { return nil }
+
+func openMemDB() (*sql.DB, error) {
+	return sql.OpenDB(&memDB{tables: make(map[string]string)}), nil
+}
+
+func tableName(query string, prefix string) string {
+	rest := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(query, prefix)), "IF NOT EXISTS ")
+	return strings.Fields(strings.ReplaceAll(rest, "(", " "))[0]
+}
+
+type memStmt struct {
+	db    *memDB
+	query string
+}
+
+func (s *memStmt) Close() error  { return nil }
+func (s *memStmt) NumInput() int { return -1 }
+
+func (s *memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.db
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+		if name := tableName(s.query, "CREATE TABLE"); d.tables[name] == "" {
+			d.tables[name] = s.query
+		}
+	case strings.HasPrefix(s.query, "DROP TABLE"):
+		delete(d.tables, tableName(s.query, "DROP TABLE"))
+	case strings.HasPrefix(s.query, "INSERT INTO schema_migrations"):
+		d.versions = append(d.versions, args[0].(string))
+		slices.Sort(d.versions)
+	case strings.HasPrefix(s.query, "DELETE FROM schema_migrations"):
+		d.versions = slices.DeleteFunc(d.versions, func(v string) bool { return v == args[0] })
+	default:
+		return nil, fmt.Errorf("unsupported statement: %s", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.db
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "SELECT version FROM schema_migrations WHERE 1 = 0"):
+		if _, ok := d.tables["schema_migrations"]; !ok {
+			return nil, fmt.Errorf("no such table: schema_migrations")
+		}
+		return &memRows{columns: []string{"version"}}, nil
+	case strings.HasPrefix(s.query, "SELECT checksum, applied_at FROM schema_migrations WHERE 1 = 0"):
+		return &memRows{columns: []string{"checksum", "applied_at"}}, nil
+	case strings.HasPrefix(s.query, "SELECT version, checksum, applied_at FROM schema_migrations"):
+		rows := &memRows{columns: []string{"version", "checksum", "applied_at"}}
+		for _, v := range d.versions {
+			rows.rows = append(rows.rows, []driver.Value{v, nil, nil})
+		}
+		return rows, nil
+	case strings.HasPrefix(s.query, "SELECT sql FROM sqlite_master"):
+		rows := &memRows{columns: []string{"sql"}}
+		for _, name := range slices.Sorted(maps.Keys(d.tables)) {
+			rows.rows = append(rows.rows, []driver.Value{d.tables[name]})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unsupported query: %s", s.query)
+}
+
+type memRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *memRows) Columns() []string { return r.columns }
+func (r *memRows) Close() error      { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
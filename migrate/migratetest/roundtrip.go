@@ -0,0 +1,73 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"github.com/SimonSchneider/goslu/migrate"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// RoundTrip applies the migrations of dir one by one to a db from newDB. Every migration is rolled back and applied
+// again, the test fails if the down section does not restore the previous schema or re-applying it results in a
+// different schema. A nil Migrator uses the defaults.
+func RoundTrip(t testing.TB, m *migrate.Migrator, dir fs.FS, newDB func() (*sql.DB, error)) {
+	t.Helper()
+	if m == nil {
+		m = &migrate.Migrator{}
+	}
+	ctx := context.Background()
+	db, err := newDB()
+	if err != nil {
+		t.Fatalf("creating db: %s", err)
+	}
+	defer db.Close()
+	dump := func() string {
+		t.Helper()
+		schema, err := migrate.DumpSchema(ctx, db, dialect(m))
+		if err != nil {
+			t.Fatalf("dumping schema: %s", err)
+		}
+		return schema
+	}
+	// Status does not create the migrations table, migrating nothing creates it so it is part of every compared schema
+	empty := *m
+	empty.GoMigrations, empty.SchemaFile = nil, ""
+	if err := empty.Migrate(ctx, fstest.MapFS{}, db); err != nil {
+		t.Fatalf("creating migrations table: %s", err)
+	}
+	status, err := m.Status(ctx, dir, db)
+	if err != nil {
+		t.Fatalf("reading migrations: %s", err)
+	}
+	for _, s := range status {
+		if s.State != migrate.StatePending {
+			t.Fatalf("expected an empty db but %s is %s", s.Version, s.State)
+		}
+		before := dump()
+		if err := m.MigrateTo(ctx, dir, db, s.Version); err != nil {
+			t.Fatalf("applying %s: %s", s.Version, err)
+		}
+		after := dump()
+		if err := m.Rollback(ctx, dir, db, 1); err != nil {
+			t.Fatalf("rolling back %s: %s", s.Version, err)
+		}
+		if diff := diffLines(before, dump()); diff != "" {
+			t.Errorf("rolling back %s does not restore the schema:\n%s", s.Version, diff)
+		}
+		if err := m.MigrateTo(ctx, dir, db, s.Version); err != nil {
+			t.Fatalf("re-applying %s: %s", s.Version, err)
+		}
+		if diff := diffLines(after, dump()); diff != "" {
+			t.Errorf("re-applying %s results in a different schema:\n%s", s.Version, diff)
+		}
+	}
+}
+
+func dialect(m *migrate.Migrator) migrate.Dialect {
+	if m.Dialect == nil {
+		return migrate.SQLite
+	}
+	return m.Dialect
+}
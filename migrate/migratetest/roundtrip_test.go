@@ -0,0 +1,28 @@
+package migratetest
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dir := fstest.MapFS{
+		"1_foo.sql": &fstest.MapFile{
+			Data: []byte("-- migrate:up\nCREATE TABLE foo (id INTEGER PRIMARY KEY);\n-- migrate:down\nDROP TABLE foo;"),
+		},
+		"2_bar.sql": &fstest.MapFile{
+			Data: []byte("-- migrate:up\nCREATE TABLE bar (id INTEGER PRIMARY KEY);\n-- migrate:down\nDROP TABLE bar;"),
+		},
+		"README.md": &fstest.MapFile{Data: []byte("# migrations")},
+	}
+	RoundTrip(t, nil, dir, openMemDB)
+
+	dir["3_baz.sql"] = &fstest.MapFile{
+		Data: []byte("-- migrate:up\nCREATE TABLE baz (id INTEGER PRIMARY KEY);\n-- migrate:down\nDROP TABLE bar;"),
+	}
+	f := failures(t, func(tb testing.TB) { RoundTrip(tb, nil, dir, openMemDB) })
+	if len(f) == 0 || !strings.Contains(f[0], "rolling back 3_baz.sql does not restore the schema") {
+		t.Fatalf("expected the broken down section to fail, got %q", f)
+	}
+}
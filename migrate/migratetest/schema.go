@@ -0,0 +1,63 @@
+// Package migratetest contains test helpers for migrations.
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/SimonSchneider/goslu/migrate"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+// UpdateEnv is the environment variable that makes AssertSchema write the snapshot instead of comparing it, e.g.
+// UPDATE_SCHEMA=1 go test ./...
+const UpdateEnv = "UPDATE_SCHEMA"
+
+// AssertSchema fails the test if the schema of the db differs from the committed snapshot at path.
+func AssertSchema(t testing.TB, db *sql.DB, dialect migrate.Dialect, path string) {
+	t.Helper()
+	schema, err := migrate.DumpSchema(context.Background(), db, dialect)
+	if err != nil {
+		t.Fatalf("dumping schema: %s", err)
+	}
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.WriteFile(path, []byte(schema), 0o644); err != nil {
+			t.Fatalf("writing schema snapshot: %s", err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("schema snapshot %s does not exist, run the test with %s=1 to create it", path, UpdateEnv)
+	} else if err != nil {
+		t.Fatalf("reading schema snapshot: %s", err)
+	}
+	if diff := diffLines(string(expected), schema); diff != "" {
+		t.Errorf("schema differs from %s, run the test with %s=1 to update it:\n%s", path, UpdateEnv, diff)
+	}
+}
+
+// diffLines describes the first differing line of the two texts, or returns an empty string if they are equal.
+func diffLines(expected, actual string) string {
+	if expected == actual {
+		return ""
+	}
+	e, a := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	for i := 0; i < max(len(e), len(a)); i++ {
+		var el, al string
+		if i < len(e) {
+			el = e[i]
+		}
+		if i < len(a) {
+			al = a[i]
+		}
+		if el != al || i >= len(e) || i >= len(a) {
+			return fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, el, al)
+		}
+	}
+	return ""
+}
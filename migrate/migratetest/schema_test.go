@@ -0,0 +1,71 @@
+package migratetest
+
+import (
+	"context"
+	"fmt"
+	"github.com/SimonSchneider/goslu/migrate"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+type fixedSchema struct {
+	migrate.Dialect
+	schema string
+}
+
+func (d fixedSchema) DumpSchema(context.Context, migrate.Queryer) (string, error) {
+	return d.schema, nil
+}
+
+type recordingTB struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// failures runs f in its own goroutine as Fatalf stops it and returns the failures.
+func failures(t *testing.T, f func(tb testing.TB)) []string {
+	rec := &recordingTB{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(rec)
+	}()
+	<-done
+	return rec.failures
+}
+
+func TestAssertSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.sql")
+	dialect := fixedSchema{Dialect: migrate.SQLite, schema: "CREATE TABLE foo (id INTEGER);\n\n"}
+
+	assert := func(tb testing.TB) { AssertSchema(tb, nil, dialect, path) }
+	if f := failures(t, assert); len(f) != 1 {
+		t.Fatalf("expected a missing snapshot to fail, got %q", f)
+	}
+
+	t.Setenv(UpdateEnv, "1")
+	AssertSchema(t, nil, dialect, path)
+	if b, err := os.ReadFile(path); err != nil || string(b) != dialect.schema {
+		t.Fatalf("expected the snapshot to be written, got %q, %v", b, err)
+	}
+	t.Setenv(UpdateEnv, "")
+	AssertSchema(t, nil, dialect, path)
+
+	dialect.schema = "CREATE TABLE foo (id INTEGER, name TEXT);\n\n"
+	if f := failures(t, assert); len(f) != 1 {
+		t.Fatalf("expected a changed schema to fail, got %q", f)
+	}
+}
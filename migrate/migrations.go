@@ -4,69 +4,261 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/SimonSchneider/goslu/srvu"
 	"io/fs"
+	"slices"
 	"sort"
+	"strings"
+	"time"
 )
 
 const (
-	startUp   = "-- migrate:up"
-	startDown = "-- migrate:down"
+	startUp       = "-- migrate:up"
+	startDown     = "-- migrate:down"
+	noTransaction = "-- migrate:notransaction"
 )
 
-func readFile(dir fs.FS, name string) ([]byte, error) {
+type migration struct {
+	version  string
+	up       []statement
+	down     []statement
+	checksum string
+	noTx     bool
+	// upFunc and downFunc are set for Go migrations instead of the statements.
+	upFunc   MigrationFunc
+	downFunc MigrationFunc
+}
+
+// readFile parses the up and down sections of the migration file, the checksum is the SHA-256 of the up section. A
+// -- migrate:notransaction line runs the migration outside of a transaction.
+func readFile(dir fs.FS, name string) (*migration, error) {
 	r, err := dir.Open(name)
-	defer r.Close()
 	if err != nil {
 		return nil, fmt.Errorf("open file: %w", err)
 	}
+	defer r.Close()
 	scanner := bufio.NewScanner(r)
 	scanner.Split(bufio.ScanLines)
-	inUp := false
-	up := make([]byte, 0)
+	var section *strings.Builder
+	var sectionLine *int
+	up, down := &strings.Builder{}, &strings.Builder{}
+	upLine, downLine := 0, 0
+	noTx := false
+	line := 0
 	for scanner.Scan() {
+		line++
 		b := scanner.Bytes()
 		trimmed := bytes.TrimSpace(b)
-		if bytes.Equal(trimmed, []byte(startDown)) {
-			break
-		}
 		if bytes.Equal(trimmed, []byte(startUp)) {
-			inUp = true
-		} else if inUp {
-			up = append(append(up, ' '), b...)
+			section, sectionLine = up, &upLine
+		} else if bytes.Equal(trimmed, []byte(startDown)) {
+			section, sectionLine = down, &downLine
+		} else if bytes.Equal(trimmed, []byte(noTransaction)) {
+			noTx = true
+		} else if section != nil {
+			if *sectionLine == 0 {
+				*sectionLine = line
+			}
+			section.Write(b)
+			section.WriteByte('\n')
 		}
 	}
-	return up, nil
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	upStmts, err := splitStatements(up.String(), upLine)
+	if err != nil {
+		return nil, fmt.Errorf("parsing up section: %w", err)
+	}
+	downStmts, err := splitStatements(down.String(), downLine)
+	if err != nil {
+		return nil, fmt.Errorf("parsing down section: %w", err)
+	}
+	sum := sha256.Sum256([]byte(up.String()))
+	return &migration{version: name, up: upStmts, down: downStmts, checksum: hex.EncodeToString(sum[:]), noTx: noTx}, nil
+}
+
+const defaultTable = "schema_migrations"
+
+// Migrator runs migrations with a configurable dialect and migrations table, the zero value uses SQLite and the
+// schema_migrations table.
+type Migrator struct {
+	Dialect Dialect
+	Table   string
+	// Checksums decides what happens when an applied migration file was edited, defaults to ChecksumFail.
+	Checksums ChecksumPolicy
+	// Logger receives warnings, defaults to the logger of the context.
+	Logger srvu.Logger
+	// Locker optionally prevents concurrent migrations, e.g. when several replicas start at once.
+	Locker Locker
+	// SkipIfLocked returns ErrLocked instead of waiting for the lock, LockPollInterval defaults to a second.
+	SkipIfLocked     bool
+	LockPollInterval time.Duration
+	// AllowOutOfOrder applies pending migrations that are older than the latest applied one, e.g. after merging
+	// branches, instead of failing with a *VersionError.
+	AllowOutOfOrder bool
+	// IgnoreUnknown logs applied versions without a migration instead of failing with a *VersionError.
+	IgnoreUnknown bool
+	// PerMigrationTx runs every migration in its own transaction instead of all in one.
+	PerMigrationTx bool
+	// SchemaFile is optionally written with the dumped schema after migrating, e.g. schema.sql next to the
+	// migrations so reviewers see the effective schema change.
+	SchemaFile string
+	// GoMigrations are migrations implemented in Go keyed by version, see Register.
+	GoMigrations map[string]GoMigration
+}
+
+func (m *Migrator) logger(ctx context.Context) srvu.Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	return srvu.GetLogger(ctx)
+}
+
+func (m *Migrator) dialect() Dialect {
+	if m.Dialect == nil {
+		return SQLite
+	}
+	return m.Dialect
+}
+
+func (m *Migrator) table() string {
+	if m.Table == "" {
+		return defaultTable
+	}
+	return m.Table
 }
 
-func initDb(ctx context.Context, db *sql.DB) error {
-	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (\n  version VARCHAR(255) PRIMARY KEY\n)"); err != nil {
+func (m *Migrator) initDb(ctx context.Context, db execQueryer) error {
+	if _, err := db.ExecContext(ctx, m.dialect().CreateTable(m.table())); err != nil {
 		return fmt.Errorf("creating migrations table: %w", err)
 	}
+	// tables created before the checksum and applied_at columns were tracked only have the version column
+	if m.probeColumns(ctx, db, "checksum, applied_at") == nil {
+		return nil
+	}
+	for _, column := range []string{"checksum VARCHAR(64)", "applied_at BIGINT"} {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", m.table(), column)); err != nil {
+			return fmt.Errorf("upgrading migrations table: %w", err)
+		}
+	}
 	return nil
 }
 
-func getMigratedVersions(ctx context.Context, q Queryer) ([]string, error) {
-	rows, err := q.QueryContext(ctx, "SELECT * FROM schema_migrations ORDER BY version ASC")
+// probeColumns selects the columns of the migrations table without reading any rows, it fails if the table or one
+// of the columns does not exist.
+func (m *Migrator) probeColumns(ctx context.Context, q Queryer, columns string) error {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE 1 = 0", columns, m.table()))
 	if err != nil {
-		return nil, fmt.Errorf("unable to query schema_migrations for existing versions: %w", err)
+		return err
+	}
+	return rows.Close()
+}
+
+type appliedVersion struct {
+	version string
+	// checksum and appliedAt are empty for migrations applied before they were tracked.
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) getMigratedVersions(ctx context.Context, q Queryer) ([]appliedVersion, error) {
+	return m.queryMigratedVersions(ctx, q, "version, checksum, applied_at")
+}
+
+// readMigratedVersions reads the applied versions without creating or upgrading the migrations table, a missing
+// table means nothing was applied and a table without the checksum and applied_at columns is read without them.
+func (m *Migrator) readMigratedVersions(ctx context.Context, q Queryer) ([]appliedVersion, error) {
+	if err := m.probeColumns(ctx, q, "version"); err != nil {
+		// only a missing table means nothing was applied, e.g. a connection error must not report every migration
+		// as pending
+		exists, existsErr := m.dialect().TableExists(ctx, q, m.table())
+		if existsErr != nil {
+			return nil, fmt.Errorf("unable to query %s: %w", m.table(), errors.Join(err, existsErr))
+		}
+		if exists {
+			return nil, fmt.Errorf("unable to query %s: %w", m.table(), err)
+		}
+		return nil, nil
+	}
+	if m.probeColumns(ctx, q, "checksum, applied_at") != nil {
+		return m.queryMigratedVersions(ctx, q, "version, NULL, NULL")
+	}
+	return m.getMigratedVersions(ctx, q)
+}
+
+func (m *Migrator) queryMigratedVersions(ctx context.Context, q Queryer, columns string) ([]appliedVersion, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY version ASC", columns, m.table()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to query %s for existing versions: %w", m.table(), err)
 	}
 	defer rows.Close()
-	existing := make([]string, 0)
+	existing := make([]appliedVersion, 0)
 	for rows.Next() {
-		existing = append(existing, "")
-		rows.Scan(&existing[len(existing)-1])
+		var a appliedVersion
+		var checksum sql.NullString
+		var appliedAt sql.NullInt64
+		if err := rows.Scan(&a.version, &checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scanning %s: %w", m.table(), err)
+		}
+		a.checksum = checksum.String
+		if appliedAt.Valid {
+			a.appliedAt = time.UnixMilli(appliedAt.Int64)
+		}
+		existing = append(existing, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", m.table(), err)
 	}
 	return existing, nil
 }
 
-func applyMigration(ctx context.Context, exec Execer, name string, b []byte) error {
-	if _, err := exec.ExecContext(ctx, string(b)); err != nil {
-		fmt.Printf("stmt: \n%s\n", string(b))
-		return fmt.Errorf("executing migration: %w", err)
+func versions(applied []appliedVersion) []string {
+	res := make([]string, len(applied))
+	for i, a := range applied {
+		res[i] = a.version
 	}
-	if _, err := exec.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES (?)", name); err != nil {
+	return res
+}
+
+// appliedOrder returns the versions in the order they were applied, by applied_at and then version. Versions applied
+// before applied_at was tracked come first in version order.
+func appliedOrder(applied []appliedVersion) []string {
+	sorted := slices.Clone(applied)
+	slices.SortStableFunc(sorted, func(a, b appliedVersion) int {
+		if c := a.appliedAt.Compare(b.appliedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.version, b.version)
+	})
+	return versions(sorted)
+}
+
+func execStatements(ctx context.Context, exec Execer, stmts []statement) error {
+	for i, stmt := range stmts {
+		if _, err := exec.ExecContext(ctx, stmt.sql); err != nil {
+			return &MigrationError{Statement: stmt.sql, Index: i + 1, Line: stmt.line, Err: err}
+		}
+	}
+	return nil
+}
+
+// record stores or removes the version of the step in the migrations table.
+func (m *Migrator) record(ctx context.Context, exec Execer, step Step) error {
+	d := m.dialect()
+	if step.Direction == Down {
+		if _, err := exec.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %s", m.table(), d.Placeholder(1)), step.Version); err != nil {
+			return fmt.Errorf("removing version: %w", err)
+		}
+		return nil
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (version, checksum, applied_at) VALUES (%s, %s, %s)", m.table(), d.Placeholder(1), d.Placeholder(2), d.Placeholder(3))
+	if _, err := exec.ExecContext(ctx, insert, step.Version, step.checksum, time.Now().UnixMilli()); err != nil {
 		return fmt.Errorf("storing version: %w", err)
 	}
 	return nil
@@ -80,6 +272,11 @@ type Queryer interface {
 	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 }
 
+type execQueryer interface {
+	Execer
+	Queryer
+}
+
 type Tx interface {
 	Execer
 	Queryer
@@ -87,44 +284,249 @@ type Tx interface {
 	Commit() error
 }
 
-func Migrate(ctx context.Context, dir fs.FS, db *sql.DB) error {
+// migrationFiles returns the migration files in dir and the .sql files that start with a digit but do not match the
+// pattern, which are likely migrations with a mistyped name. Other files, e.g. a schema.sql snapshot, are ignored.
+func migrationFiles(dir fs.FS) ([]string, []string, error) {
 	dirEntries, err := fs.ReadDir(dir, ".")
 	if err != nil {
-		return fmt.Errorf("reading dir '.': %w", err)
-	}
-	if err := initDb(ctx, db); err != nil {
-		return fmt.Errorf("initializing db: %w", err)
+		return nil, nil, fmt.Errorf("reading dir '.': %w", err)
 	}
 	sort.SliceStable(dirEntries, func(i, j int) bool {
 		return dirEntries[i].Name() < dirEntries[j].Name()
 	})
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("unable to start tx: %w", err)
+	names := make([]string, 0, len(dirEntries))
+	var suspicious []string
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		switch {
+		case dirEntry.IsDir():
+		case isMigrationFile(name):
+			names = append(names, name)
+		case strings.HasSuffix(name, ".sql") && name[0] >= '0' && name[0] <= '9':
+			suspicious = append(suspicious, name)
+		}
 	}
-	defer tx.Rollback()
-	alreadyMigratedVersions, err := getMigratedVersions(ctx, tx)
-	for i, dirEntry := range dirEntries {
-		if dirEntry.IsDir() {
-			continue
+	return names, suspicious, nil
+}
+
+type Direction string
+
+const (
+	Up   Direction = "up"
+	Down Direction = "down"
+)
+
+// Step is a single migration that is applied or reverted.
+type Step struct {
+	Version    string
+	Direction  Direction
+	Statements []string
+	// Go is set for migrations implemented by a Go function, they have no statements.
+	Go bool
+	// NoTransaction is set for migrations that run outside of a transaction.
+	NoTransaction bool
+	stmts         []statement
+	fn            MigrationFunc
+	checksum      string
+}
+
+func newStep(mig *migration, direction Direction) Step {
+	s := Step{Version: mig.version, Direction: direction, NoTransaction: mig.noTx, checksum: mig.checksum, stmts: mig.up, fn: mig.upFunc}
+	if direction == Down {
+		s.stmts, s.fn = mig.down, mig.downFunc
+	}
+	s.Go = mig.upFunc != nil || mig.downFunc != nil
+	for _, stmt := range s.stmts {
+		s.Statements = append(s.Statements, stmt.sql)
+	}
+	return s
+}
+
+// VersionError reports applied versions without a migration and pending migrations that are older than the latest
+// applied version.
+type VersionError struct {
+	Unknown    []string
+	OutOfOrder []string
+}
+
+func (e *VersionError) Error() string {
+	var problems []string
+	if len(e.Unknown) > 0 {
+		problems = append(problems, fmt.Sprintf("applied versions without a migration: %s", strings.Join(e.Unknown, ", ")))
+	}
+	if len(e.OutOfOrder) > 0 {
+		problems = append(problems, fmt.Sprintf("pending migrations older than the latest applied version: %s", strings.Join(e.OutOfOrder, ", ")))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// checkVersions returns a *VersionError for unknown applied versions and out of order migrations unless the Migrator
+// allows them.
+func (m *Migrator) checkVersions(ctx context.Context, names []string, alreadyMigratedVersions []string, pending []string) error {
+	verr := &VersionError{}
+	for _, v := range alreadyMigratedVersions {
+		if !slices.Contains(names, v) {
+			verr.Unknown = append(verr.Unknown, v)
 		}
-		name := dirEntry.Name()
-		if i < len(alreadyMigratedVersions) {
-			if name != alreadyMigratedVersions[i] {
-				return fmt.Errorf("already ran migration '%s' as version [%d] but got name %s", alreadyMigratedVersions[i], i, name)
-			} else {
-				continue
+	}
+	if len(alreadyMigratedVersions) > 0 && !m.AllowOutOfOrder {
+		latest := slices.Max(alreadyMigratedVersions)
+		for _, name := range pending {
+			if name < latest {
+				verr.OutOfOrder = append(verr.OutOfOrder, name)
 			}
 		}
-		b, err := readFile(dir, dirEntry.Name())
+	}
+	if len(verr.Unknown) > 0 && m.IgnoreUnknown {
+		m.logger(ctx).Printf("migrate: %s", &VersionError{Unknown: verr.Unknown})
+		verr.Unknown = nil
+	}
+	if len(verr.Unknown) > 0 || len(verr.OutOfOrder) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// planTo returns the steps applying all pending migrations up to and including target, or all if target is empty.
+// If target is already applied the steps revert the migrations applied after it.
+func (m *Migrator) planTo(ctx context.Context, dir fs.FS, names []string, alreadyMigratedVersions []string, target string) ([]Step, error) {
+	if i := slices.Index(alreadyMigratedVersions, target); target != "" && i >= 0 {
+		return m.planRollback(dir, alreadyMigratedVersions[i+1:])
+	}
+	var pending []string
+	for _, name := range names {
+		if !slices.Contains(alreadyMigratedVersions, name) {
+			pending = append(pending, name)
+		}
+		if name == target {
+			break
+		}
+	}
+	if err := m.checkVersions(ctx, names, alreadyMigratedVersions, pending); err != nil {
+		return nil, err
+	}
+	steps := make([]Step, 0, len(pending))
+	for _, name := range pending {
+		mig, err := m.load(dir, name)
 		if err != nil {
-			return fmt.Errorf("reading file (%s): %w", name, err)
+			return nil, err
 		}
-		if len(b) == 0 {
-			continue
+		steps = append(steps, newStep(mig, Up))
+	}
+	return steps, nil
+}
+
+// ErrIrreversible is returned when rolling back a migration without a down section or Down function.
+var ErrIrreversible = errors.New("migration is irreversible")
+
+// planRollback returns the steps reverting the given versions in reverse order.
+func (m *Migrator) planRollback(dir fs.FS, versions []string) ([]Step, error) {
+	steps := make([]Step, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		name := versions[i]
+		mig, err := m.load(dir, name)
+		if err != nil {
+			return nil, err
 		}
-		if err := applyMigration(ctx, tx, name, b); err != nil {
-			return fmt.Errorf("applying migration (%s): %w", name, err)
+		// reverting without statements would only delete the version and leave the schema behind
+		if len(mig.down) == 0 && mig.downFunc == nil {
+			return nil, &MigrationError{File: name, Direction: Down, Err: ErrIrreversible}
+		}
+		steps = append(steps, newStep(mig, Down))
+	}
+	return steps, nil
+}
+
+// MigrationError is the failure of a single migration. Statement, Index and Line are set when a statement of a file
+// failed, Index is the 1-based position of the statement in its section.
+type MigrationError struct {
+	// File is the migration file or version of the Go migration.
+	File      string
+	Direction Direction
+	Statement string
+	Index     int
+	Line      int
+	Err       error
+}
+
+func (e *MigrationError) Error() string {
+	action := "applying"
+	if e.Direction == Down {
+		action = "reverting"
+	}
+	if e.Statement != "" {
+		return fmt.Sprintf("%s migration (%s): executing statement %d (line %d): %s", action, e.File, e.Index, e.Line, e.Err)
+	}
+	if e.Direction == "" {
+		return fmt.Sprintf("migration (%s): %s", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s migration (%s): %s", action, e.File, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// RunError is returned when a migration fails, Applied lists the steps that were committed before the failure. With
+// a single transaction nothing is committed.
+type RunError struct {
+	Applied []Step
+	Err     error
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("%s (%d migrations applied before the failure)", e.Err, len(e.Applied))
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// perMigration reports whether every migration runs in its own transaction, which is the default when the dialect
+// commits implicitly on DDL anyway.
+func (m *Migrator) perMigration() bool {
+	return m.PerMigrationTx || !m.dialect().TransactionalDDL()
+}
+
+// execute runs the steps in transactions, either all in one or one per step. Steps without a transaction always run
+// by themselves.
+func (m *Migrator) execute(ctx context.Context, conn *sql.Conn, steps []Step) error {
+	var done []Step
+	for len(steps) > 0 {
+		n := 1
+		if !m.perMigration() && !steps[0].NoTransaction {
+			for n < len(steps) && !steps[n].NoTransaction {
+				n++
+			}
+		}
+		if err := m.executeGroup(ctx, conn, steps[:n]); err != nil {
+			return &RunError{Applied: done, Err: err}
+		}
+		done = append(done, steps[:n]...)
+		steps = steps[n:]
+	}
+	return nil
+}
+
+func (m *Migrator) executeGroup(ctx context.Context, conn *sql.Conn, steps []Step) error {
+	if steps[0].NoTransaction {
+		return m.executeStep(ctx, conn, steps[0], func() error {
+			return execStatements(ctx, conn, steps[0].stmts)
+		})
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start tx: %w", err)
+	}
+	defer tx.Rollback()
+	for _, step := range steps {
+		if err := m.executeStep(ctx, tx, step, func() error {
+			if step.fn != nil {
+				return step.fn(ctx, tx)
+			}
+			return execStatements(ctx, tx, step.stmts)
+		}); err != nil {
+			return err
 		}
 	}
 	if err := tx.Commit(); err != nil {
@@ -132,3 +534,120 @@ func Migrate(ctx context.Context, dir fs.FS, db *sql.DB) error {
 	}
 	return nil
 }
+
+func (m *Migrator) executeStep(ctx context.Context, exec Execer, step Step, run func() error) error {
+	err := run()
+	if err == nil {
+		if err = m.record(ctx, exec, step); err == nil {
+			return nil
+		}
+	}
+	var migErr *MigrationError
+	if !errors.As(err, &migErr) {
+		migErr = &MigrationError{Err: err}
+	}
+	migErr.File, migErr.Direction = step.Version, step.Direction
+	if migErr.Statement != "" {
+		m.logger(ctx).Printf("migrate: %s failed on line %d:\n%s", step.Version, migErr.Line, migErr.Statement)
+	}
+	return migErr
+}
+
+// inTx runs f in a transaction with the applied migrations.
+func (m *Migrator) inTx(ctx context.Context, db *sql.DB, f func(tx *sql.Tx, applied []appliedVersion) error) error {
+	return m.withConn(ctx, db, func(conn *sql.Conn) error {
+		if err := m.initDb(ctx, conn); err != nil {
+			return fmt.Errorf("initializing db: %w", err)
+		}
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("unable to start tx: %w", err)
+		}
+		defer tx.Rollback()
+		applied, err := m.getMigratedVersions(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if err := f(tx, applied); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("comitting tx: %w", err)
+		}
+		return nil
+	})
+}
+
+// run plans and executes the steps.
+func (m *Migrator) run(ctx context.Context, db *sql.DB, plan func(applied []appliedVersion) ([]Step, error)) error {
+	return m.withConn(ctx, db, func(conn *sql.Conn) error {
+		if err := m.initDb(ctx, conn); err != nil {
+			return fmt.Errorf("initializing db: %w", err)
+		}
+		applied, err := m.getMigratedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		steps, err := plan(applied)
+		if err != nil {
+			return err
+		}
+		if err := m.execute(ctx, conn, steps); err != nil {
+			return err
+		}
+		if m.SchemaFile != "" {
+			return m.writeSchema(ctx, conn)
+		}
+		return nil
+	})
+}
+
+func Migrate(ctx context.Context, dir fs.FS, db *sql.DB) error {
+	return (&Migrator{}).Migrate(ctx, dir, db)
+}
+
+// MigrateTo migrates the db to the version, applying pending migrations up to and including it or reverting the
+// migrations applied after it. An empty version applies all migrations.
+func MigrateTo(ctx context.Context, dir fs.FS, db *sql.DB, version string) error {
+	return (&Migrator{}).MigrateTo(ctx, dir, db, version)
+}
+
+// Rollback reverts the last steps applied migrations by running their down sections in reverse order.
+func Rollback(ctx context.Context, dir fs.FS, db *sql.DB, steps int) error {
+	return (&Migrator{}).Rollback(ctx, dir, db, steps)
+}
+
+func (m *Migrator) Migrate(ctx context.Context, dir fs.FS, db *sql.DB) error {
+	return m.MigrateTo(ctx, dir, db, "")
+}
+
+func (m *Migrator) MigrateTo(ctx context.Context, dir fs.FS, db *sql.DB, version string) error {
+	names, err := m.migrationNames(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if version != "" && !slices.Contains(names, version) {
+		return fmt.Errorf("unknown version '%s'", version)
+	}
+	return m.run(ctx, db, func(applied []appliedVersion) ([]Step, error) {
+		if err := m.verifyChecksums(ctx, dir, names, applied); err != nil {
+			return nil, err
+		}
+		return m.planTo(ctx, dir, names, versions(applied), version)
+	})
+}
+
+func (m *Migrator) Rollback(ctx context.Context, dir fs.FS, db *sql.DB, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be greater than 0")
+	}
+	return m.run(ctx, db, func(applied []appliedVersion) ([]Step, error) {
+		// the most recently applied migrations are reverted, which differ from the latest versions after applying
+		// migrations out of order
+		alreadyMigratedVersions := appliedOrder(applied)
+		if steps > len(alreadyMigratedVersions) {
+			return nil, fmt.Errorf("cannot roll back %d steps, only %d migrations applied", steps, len(alreadyMigratedVersions))
+		}
+		return m.planRollback(dir, alreadyMigratedVersions[len(alreadyMigratedVersions)-steps:])
+	})
+}
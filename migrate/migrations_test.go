@@ -2,10 +2,18 @@ package migrate_test
 
 import (
 	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"github.com/SimonSchneider/goslu/migrate"
+	"github.com/SimonSchneider/goslu/srvu"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 )
 
 func TestMigrate(t *testing.T) {
@@ -24,6 +32,7 @@ func TestMigrate(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	drvr.Reset()
 	if err := migrate.Migrate(context.Background(), dir, db); err != nil {
 		t.Fatal(err)
 	}
@@ -32,3 +41,518 @@ func TestMigrate(t *testing.T) {
 	//	t.Logf("stmt %d (tx %s): %s, %v", i, stmt.tx, stmt.query, stmt.args)
 	//}
 }
+
+var rollbackDir = fstest.MapFS{
+	"1.sql": &fstest.MapFile{
+		Data: []byte("-- migrate:up\nCREATE TABLE foo (id INTEGER PRIMARY KEY);\n-- migrate:down\nDROP TABLE foo;"),
+	},
+	"2.sql": &fstest.MapFile{
+		Data: []byte("-- migrate:up\nCREATE TABLE bar (id INTEGER PRIMARY KEY);\n-- migrate:down\nDROP TABLE bar;"),
+	},
+	"3.sql": &fstest.MapFile{
+		Data: []byte("-- migrate:up\nCREATE TABLE baz (id INTEGER PRIMARY KEY);\n-- migrate:down\nDROP TABLE baz;"),
+	},
+}
+
+func expectExecuted(t *testing.T, drvr *FakeDriver, expected ...string) {
+	t.Helper()
+	executed := drvr.Executed()
+	// the first statements create and check the migrations table and query the applied versions
+	executed = executed[3:]
+	if len(executed) != len(expected) {
+		t.Fatalf("expected %d statements, got %d:\n%s", len(expected), len(executed), drvr)
+	}
+	for i := range expected {
+		if strings.TrimSpace(executed[i]) != expected[i] {
+			t.Errorf("statement %d: expected %q, got %q", i, expected[i], executed[i])
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	if err := migrate.Rollback(context.Background(), rollbackDir, db, 2); err != nil {
+		t.Fatal(err)
+	}
+	expectExecuted(t, drvr,
+		"DROP TABLE baz",
+		"DELETE FROM schema_migrations WHERE version = ?",
+		"DROP TABLE bar",
+		"DELETE FROM schema_migrations WHERE version = ?",
+	)
+	drvr.Reset("1.sql")
+	if err := migrate.Rollback(context.Background(), rollbackDir, db, 2); err == nil {
+		t.Fatal("expected error when rolling back more than applied")
+	}
+	// 2.sql was applied out of order after 3.sql, 1.sql before applied_at was tracked
+	drvr.ResetApplied(
+		FakeVersion{Version: "1.sql"},
+		FakeVersion{Version: "2.sql", AppliedAt: 1700000002000},
+		FakeVersion{Version: "3.sql", AppliedAt: 1700000001000},
+	)
+	if err := migrate.Rollback(context.Background(), rollbackDir, db, 3); err != nil {
+		t.Fatal(err)
+	}
+	expectExecuted(t, drvr,
+		"DROP TABLE bar",
+		"DELETE FROM schema_migrations WHERE version = ?",
+		"DROP TABLE baz",
+		"DELETE FROM schema_migrations WHERE version = ?",
+		"DROP TABLE foo",
+		"DELETE FROM schema_migrations WHERE version = ?",
+	)
+}
+
+func TestRollbackIrreversible(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := fstest.MapFS{
+		"1.sql": &fstest.MapFile{Data: []byte("-- migrate:up\nCREATE TABLE foo (id INTEGER PRIMARY KEY);\n-- migrate:down\nDROP TABLE foo;")},
+		"2.sql": &fstest.MapFile{Data: []byte("-- migrate:up\nCREATE TABLE bar (id INTEGER PRIMARY KEY);\n-- migrate:down\n")},
+	}
+	drvr.Reset("1.sql", "2.sql")
+	if err := migrate.Rollback(context.Background(), dir, db, 1); !errors.Is(err, migrate.ErrIrreversible) {
+		t.Fatalf("expected irreversible error, got %v", err)
+	}
+	m := (&migrate.Migrator{}).Register("3", func(ctx context.Context, tx migrate.Tx) error { return nil }, nil)
+	drvr.Reset("1.sql", "2.sql", "3")
+	if err := m.MigrateTo(context.Background(), dir, db, "1.sql"); !errors.Is(err, migrate.ErrIrreversible) {
+		t.Fatalf("expected irreversible error, got %v", err)
+	}
+	expectExecuted(t, drvr)
+}
+
+func TestMigrateTo(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	drvr.Reset("1.sql")
+	if err := migrate.MigrateTo(context.Background(), rollbackDir, db, "2.sql"); err != nil {
+		t.Fatal(err)
+	}
+	expectExecuted(t, drvr,
+		"CREATE TABLE bar (id INTEGER PRIMARY KEY)",
+		"INSERT INTO schema_migrations (version, checksum, applied_at) VALUES (?, ?, ?)",
+	)
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	if err := migrate.MigrateTo(context.Background(), rollbackDir, db, "1.sql"); err != nil {
+		t.Fatal(err)
+	}
+	expectExecuted(t, drvr,
+		"DROP TABLE baz",
+		"DELETE FROM schema_migrations WHERE version = ?",
+		"DROP TABLE bar",
+		"DELETE FROM schema_migrations WHERE version = ?",
+	)
+	if err := migrate.MigrateTo(context.Background(), rollbackDir, db, "4.sql"); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+}
+
+func TestMigrateWithDialect(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	drvr.Reset("1.sql", "2.sql")
+	m := &migrate.Migrator{Dialect: migrate.Postgres, Table: "app.migrations"}
+	if err := m.Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Rollback(context.Background(), rollbackDir, db, 1); err != nil {
+		t.Fatal(err)
+	}
+	executed := drvr.Executed()
+	expected := []string{
+		"CREATE TABLE IF NOT EXISTS app.migrations (\n  version VARCHAR(255) PRIMARY KEY,\n  checksum VARCHAR(64),\n  applied_at BIGINT\n)",
+		"SELECT checksum, applied_at FROM app.migrations WHERE 1 = 0",
+		"SELECT version, checksum, applied_at FROM app.migrations ORDER BY version ASC",
+		"CREATE TABLE baz (id INTEGER PRIMARY KEY)",
+		"INSERT INTO app.migrations (version, checksum, applied_at) VALUES ($1, $2, $3)",
+		"CREATE TABLE IF NOT EXISTS app.migrations (\n  version VARCHAR(255) PRIMARY KEY,\n  checksum VARCHAR(64),\n  applied_at BIGINT\n)",
+		"SELECT checksum, applied_at FROM app.migrations WHERE 1 = 0",
+		"SELECT version, checksum, applied_at FROM app.migrations ORDER BY version ASC",
+		"DROP TABLE bar",
+		"DELETE FROM app.migrations WHERE version = $1",
+	}
+	if strings.Join(executed, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected statements:\n%s", drvr)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := fstest.MapFS{
+		"1.sql": rollbackDir["1.sql"],
+		"2.sql": rollbackDir["2.sql"],
+		"4.sql": rollbackDir["3.sql"],
+	}
+	drvr.ResetApplied(
+		FakeVersion{Version: "1.sql", Checksum: "abc", AppliedAt: 1700000000000},
+		FakeVersion{Version: "3.sql"},
+	)
+	status, err := migrate.Status(context.Background(), dir, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		version string
+		state   migrate.State
+	}{
+		{"1.sql", migrate.StateApplied},
+		{"2.sql", migrate.StateOutOfOrder},
+		{"3.sql", migrate.StateMissing},
+		{"4.sql", migrate.StatePending},
+	}
+	if len(status) != len(expected) {
+		t.Fatalf("expected %d migrations, got %+v", len(expected), status)
+	}
+	for i, e := range expected {
+		if status[i].Version != e.version || status[i].State != e.state {
+			t.Errorf("migration %d: expected %s %s, got %s %s", i, e.version, e.state, status[i].Version, status[i].State)
+		}
+	}
+	if !status[0].AppliedAt.Equal(time.UnixMilli(1700000000000)) || status[0].AppliedChecksum != "abc" {
+		t.Errorf("unexpected applied migration: %+v", status[0])
+	}
+	if len(status[0].Checksum) != 64 || status[2].Checksum != "" {
+		t.Errorf("unexpected checksums: %+v", status)
+	}
+}
+
+func TestStatusReadOnly(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNoDDL := func() {
+		t.Helper()
+		for _, stmt := range drvr.Executed() {
+			if strings.HasPrefix(stmt, "CREATE") || strings.HasPrefix(stmt, "ALTER") {
+				t.Errorf("status executed %q", stmt)
+			}
+		}
+	}
+	drvr.Reset("1.sql")
+	drvr.Fail("SELECT version FROM schema_migrations WHERE 1 = 0", errors.New("no such table"))
+	drvr.Respond("SELECT COUNT(*) FROM sqlite_master", []string{"n"}, int64(0))
+	status, err := migrate.Status(context.Background(), rollbackDir, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.State != migrate.StatePending {
+			t.Errorf("expected %s to be pending without a migrations table, got %s", s.Version, s.State)
+		}
+	}
+	if plan, err := migrate.Plan(context.Background(), rollbackDir, db); err != nil || len(plan) != 3 {
+		t.Errorf("expected every migration to be planned, got %+v (%v)", plan, err)
+	}
+	expectNoDDL()
+
+	drvr.Reset("1.sql")
+	drvr.Fail("SELECT version FROM schema_migrations WHERE 1 = 0", errors.New("connection refused"))
+	drvr.Respond("SELECT COUNT(*) FROM sqlite_master", []string{"n"}, int64(1))
+	if _, err := migrate.Status(context.Background(), rollbackDir, db); err == nil {
+		t.Error("expected the error of an existing table to be returned")
+	}
+
+	drvr.Reset("1.sql")
+	drvr.Fail("SELECT checksum, applied_at FROM schema_migrations WHERE 1 = 0", errors.New("no such column"))
+	status, err = migrate.Status(context.Background(), rollbackDir, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 3 || status[0].State != migrate.StateApplied || status[1].State != migrate.StatePending {
+		t.Errorf("unexpected status of a table without checksums: %+v", status)
+	}
+	expectNoDDL()
+}
+
+func TestPlan(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	drvr.Reset("1.sql")
+	plan, err := migrate.Plan(context.Background(), rollbackDir, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 2 || plan[0].Version != "2.sql" || plan[1].Version != "3.sql" || plan[0].Direction != migrate.Up {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if strings.Join(plan[1].Statements, ";") != "CREATE TABLE baz (id INTEGER PRIMARY KEY)" {
+		t.Errorf("unexpected statements: %q", plan[1].Statements)
+	}
+	for _, stmt := range drvr.Executed() {
+		if strings.HasPrefix(stmt, "CREATE TABLE b") || strings.HasPrefix(stmt, "INSERT") {
+			t.Errorf("plan executed %q", stmt)
+		}
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := FakeVersion{Version: "1.sql", Checksum: "edited", AppliedAt: 1700000000000}
+	drvr.ResetApplied(edited)
+	if err := migrate.Migrate(context.Background(), rollbackDir, db); !errors.Is(err, migrate.ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := migrate.Plan(context.Background(), rollbackDir, db); !errors.Is(err, migrate.ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch from plan, got %v", err)
+	}
+
+	var logged []string
+	m := &migrate.Migrator{Checksums: migrate.ChecksumWarn, Logger: srvu.LoggerFunc(func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})}
+	drvr.ResetApplied(edited)
+	if err := m.Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "1.sql") {
+		t.Errorf("expected a warning for 1.sql, got %q", logged)
+	}
+
+	drvr.ResetApplied(edited, FakeVersion{Version: "2.sql"})
+	if err := migrate.Repair(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	expectExecuted(t, drvr,
+		"UPDATE schema_migrations SET checksum = ? WHERE version = ?",
+		"UPDATE schema_migrations SET checksum = ? WHERE version = ?",
+	)
+}
+
+func TestGoMigrations(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := (&migrate.Migrator{}).Register("2a", func(ctx context.Context, tx migrate.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE bar SET name = ?", "computed")
+		return err
+	}, func(ctx context.Context, tx migrate.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE bar SET name = NULL")
+		return err
+	})
+	drvr.Reset("1.sql")
+	if err := m.Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	expectExecuted(t, drvr,
+		"CREATE TABLE bar (id INTEGER PRIMARY KEY)",
+		"INSERT INTO schema_migrations (version, checksum, applied_at) VALUES (?, ?, ?)",
+		"UPDATE bar SET name = ?",
+		"INSERT INTO schema_migrations (version, checksum, applied_at) VALUES (?, ?, ?)",
+		"CREATE TABLE baz (id INTEGER PRIMARY KEY)",
+		"INSERT INTO schema_migrations (version, checksum, applied_at) VALUES (?, ?, ?)",
+	)
+	drvr.Reset("1.sql", "2.sql", "2a", "3.sql")
+	if err := m.Rollback(context.Background(), rollbackDir, db, 2); err != nil {
+		t.Fatal(err)
+	}
+	expectExecuted(t, drvr,
+		"DROP TABLE baz",
+		"DELETE FROM schema_migrations WHERE version = ?",
+		"UPDATE bar SET name = NULL",
+		"DELETE FROM schema_migrations WHERE version = ?",
+	)
+	m.Register("3.sql", nil, nil)
+	if err := m.Migrate(context.Background(), rollbackDir, db); err == nil {
+		t.Fatal("expected error for a version that is both a file and a Go migration")
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := fstest.MapFS{
+		"1.sql": rollbackDir["1.sql"],
+		"2.sql": &fstest.MapFile{
+			Data: []byte("-- migrate:notransaction\n-- migrate:up\nCREATE INDEX CONCURRENTLY foo_id ON foo (id);"),
+		},
+		"3.sql": rollbackDir["2.sql"],
+		"4.sql": rollbackDir["3.sql"],
+	}
+	drvr.Reset()
+	if err := migrate.Migrate(context.Background(), dir, db); err != nil {
+		t.Fatal(err)
+	}
+	if !drvr.InTx("CREATE TABLE foo (id INTEGER PRIMARY KEY)") || !drvr.InTx("CREATE TABLE bar (id INTEGER PRIMARY KEY)") {
+		t.Errorf("expected migrations to run in a transaction:\n%s", drvr)
+	}
+	if drvr.InTx("CREATE INDEX CONCURRENTLY foo_id ON foo (id)") {
+		t.Errorf("expected the notransaction migration to run outside of a transaction:\n%s", drvr)
+	}
+
+	drvr.Reset()
+	drvr.Fail("CREATE TABLE baz", errors.New("boom"))
+	m := &migrate.Migrator{PerMigrationTx: true}
+	err = m.Migrate(context.Background(), dir, db)
+	var runErr *migrate.RunError
+	if !errors.As(err, &runErr) {
+		t.Fatalf("expected a RunError, got %v", err)
+	}
+	var applied []string
+	for _, step := range runErr.Applied {
+		applied = append(applied, step.Version)
+	}
+	if strings.Join(applied, ",") != "1.sql,2.sql,3.sql" {
+		t.Errorf("unexpected applied migrations: %v", applied)
+	}
+}
+
+func TestMigrationError(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	drvr.Reset("1.sql", "2.sql", "3.sql", "4.sql")
+	var migErr *migrate.MigrationError
+	err = migrate.Rollback(context.Background(), rollbackDir, db, 1)
+	if !errors.As(err, &migErr) || migErr.File != "4.sql" || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a missing file error for 4.sql, got %v", err)
+	}
+
+	var logged []string
+	m := &migrate.Migrator{Logger: srvu.LoggerFunc(func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})}
+	drvr.Reset("1.sql")
+	drvr.Fail("CREATE TABLE bar", errors.New("boom"))
+	err = m.Migrate(context.Background(), rollbackDir, db)
+	if !errors.As(err, &migErr) {
+		t.Fatalf("expected a MigrationError, got %v", err)
+	}
+	if migErr.File != "2.sql" || migErr.Direction != migrate.Up || migErr.Index != 1 || migErr.Line != 2 || migErr.Statement != "CREATE TABLE bar (id INTEGER PRIMARY KEY)" {
+		t.Errorf("unexpected error: %+v", migErr)
+	}
+	if !strings.Contains(err.Error(), "applying migration (2.sql): executing statement 1 (line 2): boom") {
+		t.Errorf("unexpected message: %s", err)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "CREATE TABLE bar") {
+		t.Errorf("expected the failing statement to be logged, got %q", logged)
+	}
+}
+
+func TestVersionPolicies(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	drvr.Reset("1.sql", "3.sql")
+	var verr *migrate.VersionError
+	if err := migrate.Migrate(context.Background(), rollbackDir, db); !errors.As(err, &verr) || strings.Join(verr.OutOfOrder, ",") != "2.sql" {
+		t.Fatalf("expected 2.sql to be out of order, got %v", err)
+	}
+	drvr.Reset("1.sql", "3.sql")
+	if err := (&migrate.Migrator{AllowOutOfOrder: true}).Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	expectExecuted(t, drvr,
+		"CREATE TABLE bar (id INTEGER PRIMARY KEY)",
+		"INSERT INTO schema_migrations (version, checksum, applied_at) VALUES (?, ?, ?)",
+	)
+
+	drvr.Reset("1.sql", "2.sql", "2b.sql", "3.sql", "9.sql")
+	if err := migrate.Migrate(context.Background(), rollbackDir, db); !errors.As(err, &verr) || strings.Join(verr.Unknown, ",") != "2b.sql,9.sql" {
+		t.Fatalf("expected unknown versions, got %v", err)
+	}
+	var logged []string
+	m := &migrate.Migrator{IgnoreUnknown: true, Logger: srvu.LoggerFunc(func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})}
+	drvr.Reset("1.sql", "2.sql", "2b.sql", "3.sql", "9.sql")
+	if err := m.Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "2b.sql, 9.sql") {
+		t.Errorf("expected the unknown versions to be logged, got %q", logged)
+	}
+}
+
+func TestSchemaFile(t *testing.T) {
+	db, drvr, err := OpenFakeDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "schema.sql")
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	drvr.RespondRows("SELECT sql FROM sqlite_master", []string{"sql"},
+		[]driver.Value{"CREATE TABLE bar (id INTEGER PRIMARY KEY)"},
+		[]driver.Value{"CREATE TABLE foo (id INTEGER PRIMARY KEY)"},
+	)
+	if err := (&migrate.Migrator{SchemaFile: path}).Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, path, "CREATE TABLE bar (id INTEGER PRIMARY KEY);\n\nCREATE TABLE foo (id INTEGER PRIMARY KEY);\n\n")
+
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	drvr.RespondRows("SELECT table_name, column_name", []string{"table_name", "column_name", "data_type", "is_nullable", "column_default"},
+		[]driver.Value{"bar", "id", "integer", "NO", nil},
+		[]driver.Value{"foo", "id", "integer", "NO", "nextval('foo_id_seq'::regclass)"},
+		[]driver.Value{"foo", "name", "text", "YES", nil},
+	)
+	drvr.RespondRows("SELECT cl.relname", []string{"relname", "conname", "def"},
+		[]driver.Value{"foo", "foo_pkey", "PRIMARY KEY (id)"},
+	)
+	drvr.RespondRows("SELECT tablename, indexdef", []string{"tablename", "indexdef"},
+		[]driver.Value{"foo", "CREATE INDEX foo_name ON public.foo USING btree (name)"},
+	)
+	if err := (&migrate.Migrator{Dialect: migrate.Postgres, SchemaFile: path}).Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, path, "CREATE TABLE bar (\n  id integer NOT NULL\n);\n\nCREATE TABLE foo (\n  id integer NOT NULL DEFAULT nextval('foo_id_seq'::regclass),\n  name text,\n  CONSTRAINT foo_pkey PRIMARY KEY (id)\n);\nCREATE INDEX foo_name ON public.foo USING btree (name);\n")
+
+	drvr.Reset("1.sql", "2.sql", "3.sql")
+	drvr.RespondRows("SELECT table_name, column_name", []string{"table_name", "column_name", "column_type", "is_nullable", "column_default"},
+		[]driver.Value{"bar", "id", "int", "NO", nil},
+		[]driver.Value{"bar", "foo_id", "int", "YES", nil},
+		[]driver.Value{"foo", "id", "int", "NO", nil},
+		[]driver.Value{"foo", "a", "int", "NO", nil},
+		[]driver.Value{"foo", "b", "int", "NO", nil},
+	)
+	drvr.RespondRows("SELECT table_name, index_name", []string{"table_name", "index_name", "non_unique", "column_name"},
+		[]driver.Value{"bar", "PRIMARY", int64(0), "id"},
+		[]driver.Value{"foo", "PRIMARY", int64(0), "id"},
+		[]driver.Value{"foo", "foo_ab", int64(0), "a"},
+		[]driver.Value{"foo", "foo_ab", int64(0), "b"},
+		[]driver.Value{"foo", "foo_b", int64(1), "b"},
+	)
+	drvr.RespondRows("SELECT table_name, constraint_name", []string{"table_name", "constraint_name", "column_name", "referenced_table_name", "referenced_column_name"},
+		[]driver.Value{"bar", "bar_foo", "foo_id", "foo", "id"},
+	)
+	if err := (&migrate.Migrator{Dialect: migrate.MySQL, SchemaFile: path}).Migrate(context.Background(), rollbackDir, db); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, path, "CREATE TABLE bar (\n  id int NOT NULL,\n  foo_id int,\n  PRIMARY KEY (id),\n  CONSTRAINT bar_foo FOREIGN KEY (foo_id) REFERENCES foo (id)\n);\n\n"+
+		"CREATE TABLE foo (\n  id int NOT NULL,\n  a int NOT NULL,\n  b int NOT NULL,\n  PRIMARY KEY (id)\n);\nCREATE UNIQUE INDEX foo_ab ON foo (a, b);\nCREATE INDEX foo_b ON foo (b);\n")
+}
+
+func expectFile(t *testing.T, path string, expected string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expected {
+		t.Errorf("unexpected %s:\n%s", path, b)
+	}
+}
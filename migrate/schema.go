@@ -0,0 +1,227 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// dumpSQLite returns the DDL of all tables, indexes, views and triggers from sqlite_master.
+func dumpSQLite(ctx context.Context, q Queryer) (string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY type, name")
+	if err != nil {
+		return "", fmt.Errorf("querying sqlite_master: %w", err)
+	}
+	defer rows.Close()
+	b := &strings.Builder{}
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return "", fmt.Errorf("scanning sqlite_master: %w", err)
+		}
+		fmt.Fprintf(b, "%s;\n\n", strings.TrimSpace(stmt))
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("reading sqlite_master: %w", err)
+	}
+	return b.String(), nil
+}
+
+// tableSchema is a table of a dump, constraints are written after the columns in the CREATE TABLE statement and
+// indexes as separate statements after it.
+type tableSchema struct {
+	columns     []string
+	constraints []string
+	indexes     []string
+}
+
+// schemaDump builds the dump of databases without a catalog of DDL statements from their information schema.
+type schemaDump map[string]*tableSchema
+
+func (d schemaDump) table(name string) *tableSchema {
+	t, ok := d[name]
+	if !ok {
+		t = &tableSchema{}
+		d[name] = t
+	}
+	return t
+}
+
+func (d schemaDump) String() string {
+	b := &strings.Builder{}
+	for i, name := range slices.Sorted(maps.Keys(d)) {
+		t := d[name]
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "CREATE TABLE %s (\n  %s\n);\n", name, strings.Join(slices.Concat(t.columns, t.constraints), ",\n  "))
+		for _, index := range t.indexes {
+			fmt.Fprintf(b, "%s;\n", index)
+		}
+	}
+	return b.String()
+}
+
+// eachRow calls f for every row of the query, name is the catalog used in errors.
+func eachRow(ctx context.Context, q Queryer, name string, query string, f func(rows *sql.Rows) error) error {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("querying %s: %w", name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := f(rows); err != nil {
+			return fmt.Errorf("scanning %s: %w", name, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	return nil
+}
+
+// addColumns adds the columns of information_schema.columns, the query selects the table, column, type, nullability
+// and default ordered by table and position.
+func (d schemaDump) addColumns(ctx context.Context, q Queryer, query string) error {
+	return eachRow(ctx, q, "information_schema.columns", query, func(rows *sql.Rows) error {
+		var tbl, column, typ, nullable string
+		var def sql.NullString
+		if err := rows.Scan(&tbl, &column, &typ, &nullable, &def); err != nil {
+			return err
+		}
+		col := column + " " + typ
+		if nullable == "NO" {
+			col += " NOT NULL"
+		}
+		if def.Valid {
+			col += " DEFAULT " + def.String
+		}
+		t := d.table(tbl)
+		t.columns = append(t.columns, col)
+		return nil
+	})
+}
+
+func dumpPostgres(ctx context.Context, q Queryer) (string, error) {
+	d := schemaDump{}
+	if err := d.addColumns(ctx, q, "SELECT table_name, column_name, data_type, is_nullable, column_default FROM information_schema.columns WHERE table_schema = current_schema() ORDER BY table_name, ordinal_position"); err != nil {
+		return "", err
+	}
+	// primary key, unique, foreign key and check constraints with their definition, not null is part of the columns
+	err := eachRow(ctx, q, "pg_constraint", "SELECT cl.relname, co.conname, pg_get_constraintdef(co.oid) FROM pg_constraint co JOIN pg_class cl ON cl.oid = co.conrelid JOIN pg_namespace n ON n.oid = co.connamespace WHERE n.nspname = current_schema() AND co.contype IN ('p', 'u', 'f', 'c') ORDER BY cl.relname, co.conname", func(rows *sql.Rows) error {
+		var tbl, name, def string
+		if err := rows.Scan(&tbl, &name, &def); err != nil {
+			return err
+		}
+		t := d.table(tbl)
+		t.constraints = append(t.constraints, fmt.Sprintf("CONSTRAINT %s %s", name, def))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	// the indexes backing constraints are named like the constraint and already covered by it
+	err = eachRow(ctx, q, "pg_indexes", "SELECT tablename, indexdef FROM pg_indexes WHERE schemaname = current_schema() AND indexname NOT IN (SELECT co.conname FROM pg_constraint co JOIN pg_namespace n ON n.oid = co.connamespace WHERE n.nspname = current_schema()) ORDER BY tablename, indexname", func(rows *sql.Rows) error {
+		var tbl, def string
+		if err := rows.Scan(&tbl, &def); err != nil {
+			return err
+		}
+		t := d.table(tbl)
+		t.indexes = append(t.indexes, def)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+type mysqlIndex struct {
+	table, name string
+	unique      bool
+	columns     []string
+}
+
+type mysqlForeignKey struct {
+	table, name, refTable string
+	columns, refColumns   []string
+}
+
+func dumpMySQL(ctx context.Context, q Queryer) (string, error) {
+	d := schemaDump{}
+	if err := d.addColumns(ctx, q, "SELECT table_name, column_name, column_type, is_nullable, column_default FROM information_schema.columns WHERE table_schema = DATABASE() ORDER BY table_name, ordinal_position"); err != nil {
+		return "", err
+	}
+	// the primary key and unique constraints are indexes in MySQL, the columns of an index are consecutive rows
+	var indexes []*mysqlIndex
+	err := eachRow(ctx, q, "information_schema.statistics", "SELECT table_name, index_name, non_unique, column_name FROM information_schema.statistics WHERE table_schema = DATABASE() ORDER BY table_name, index_name, seq_in_index", func(rows *sql.Rows) error {
+		var tbl, name string
+		var nonUnique int64
+		var column sql.NullString
+		if err := rows.Scan(&tbl, &name, &nonUnique, &column); err != nil {
+			return err
+		}
+		if len(indexes) == 0 || indexes[len(indexes)-1].table != tbl || indexes[len(indexes)-1].name != name {
+			indexes = append(indexes, &mysqlIndex{table: tbl, name: name, unique: nonUnique == 0})
+		}
+		idx := indexes[len(indexes)-1]
+		idx.columns = append(idx.columns, column.String)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, idx := range indexes {
+		t := d.table(idx.table)
+		columns := strings.Join(idx.columns, ", ")
+		switch {
+		case idx.name == "PRIMARY":
+			t.constraints = append(t.constraints, fmt.Sprintf("PRIMARY KEY (%s)", columns))
+		case idx.unique:
+			t.indexes = append(t.indexes, fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", idx.name, idx.table, columns))
+		default:
+			t.indexes = append(t.indexes, fmt.Sprintf("CREATE INDEX %s ON %s (%s)", idx.name, idx.table, columns))
+		}
+	}
+	var fks []*mysqlForeignKey
+	err = eachRow(ctx, q, "information_schema.key_column_usage", "SELECT table_name, constraint_name, column_name, referenced_table_name, referenced_column_name FROM information_schema.key_column_usage WHERE table_schema = DATABASE() AND referenced_table_name IS NOT NULL ORDER BY table_name, constraint_name, ordinal_position", func(rows *sql.Rows) error {
+		var tbl, name, column, refTable, refColumn string
+		if err := rows.Scan(&tbl, &name, &column, &refTable, &refColumn); err != nil {
+			return err
+		}
+		if len(fks) == 0 || fks[len(fks)-1].table != tbl || fks[len(fks)-1].name != name {
+			fks = append(fks, &mysqlForeignKey{table: tbl, name: name, refTable: refTable})
+		}
+		fk := fks[len(fks)-1]
+		fk.columns, fk.refColumns = append(fk.columns, column), append(fk.refColumns, refColumn)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, fk := range fks {
+		t := d.table(fk.table)
+		t.constraints = append(t.constraints, fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)", fk.name, strings.Join(fk.columns, ", "), fk.refTable, strings.Join(fk.refColumns, ", ")))
+	}
+	return d.String(), nil
+}
+
+// DumpSchema returns the schema of the db as deterministic SQL.
+func DumpSchema(ctx context.Context, db *sql.DB, dialect Dialect) (string, error) {
+	return dialect.DumpSchema(ctx, db)
+}
+
+func (m *Migrator) writeSchema(ctx context.Context, q Queryer) error {
+	schema, err := m.dialect().DumpSchema(ctx, q)
+	if err != nil {
+		return fmt.Errorf("dumping schema: %w", err)
+	}
+	if err := os.WriteFile(m.SchemaFile, []byte(schema), 0o644); err != nil {
+		return fmt.Errorf("writing schema: %w", err)
+	}
+	return nil
+}
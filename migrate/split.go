@@ -0,0 +1,152 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+type statement struct {
+	sql string
+	// line is the 1-based line in the migration file where the statement starts.
+	line int
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// dollarTag returns the $tag$ starting at i or an empty string if there is none.
+func dollarTag(s string, i int) string {
+	if i > 0 && isIdentChar(s[i-1]) {
+		return ""
+	}
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == '$' {
+			if j > i+1 && s[i+1] >= '0' && s[i+1] <= '9' {
+				return "" // positional parameter like $1
+			}
+			return s[i : j+1]
+		}
+		if !isIdentChar(s[j]) {
+			return ""
+		}
+	}
+	return ""
+}
+
+// splitStatements splits sql into its statements on top-level semicolons. Quoted strings and identifiers, dollar
+// quoted strings, comments and BEGIN ... END blocks of CREATE statements (e.g. trigger bodies) are not split.
+// firstLine is the line of the file where sql starts.
+func splitStatements(sql string, firstLine int) ([]statement, error) {
+	var stmts []statement
+	line := firstLine
+	start, startLine := -1, 0
+	depth := 0
+	isCreate := false
+	flush := func(end int) {
+		if start >= 0 {
+			stmts = append(stmts, statement{sql: strings.TrimSpace(sql[start:end]), line: startLine})
+		}
+		start, depth, isCreate = -1, 0, false
+	}
+	markStart := func(i int) {
+		if start < 0 {
+			start, startLine = i, line
+		}
+	}
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\n':
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			openLine := line
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated block comment", openLine)
+			}
+			line += strings.Count(sql[i:i+2+end+2], "\n")
+			i += 2 + end + 1
+		case c == '\'' || c == '"' || c == '`':
+			markStart(i)
+			openLine := line
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == '\n' {
+					line++
+				}
+				if sql[j] == c {
+					if j+1 < len(sql) && sql[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(sql) {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", openLine)
+			}
+			i = j
+		case c == '$' && dollarTag(sql, i) != "":
+			markStart(i)
+			tag := dollarTag(sql, i)
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated dollar quoted string %s", line, tag)
+			}
+			line += strings.Count(sql[i:i+len(tag)+end], "\n")
+			i += len(tag) + end + len(tag) - 1
+		case c == ';':
+			if depth == 0 {
+				flush(i)
+				continue
+			}
+		case isIdentChar(c):
+			markStart(i)
+			j := i
+			for j < len(sql) && isIdentChar(sql[j]) {
+				j++
+			}
+			word := strings.ToUpper(sql[i:j])
+			if start == i && word == "CREATE" {
+				isCreate = true
+			}
+			if isCreate {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					next := strings.ToUpper(nextWord(sql, j))
+					if next != "IF" && next != "LOOP" && next != "WHILE" && next != "REPEAT" && depth > 0 {
+						depth--
+					}
+				}
+			}
+			i = j - 1
+		default:
+			markStart(i)
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("line %d: unterminated BEGIN block", startLine)
+	}
+	flush(len(sql))
+	return stmts, nil
+}
+
+func nextWord(s string, i int) string {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\n') {
+		i++
+	}
+	j := i
+	for j < len(s) && isIdentChar(s[j]) {
+		j++
+	}
+	return s[i:j]
+}
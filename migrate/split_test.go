@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       string
+		firstLine int
+		stmts     []statement
+	}{
+		{
+			name:  "comments between lines",
+			sql:   "CREATE TABLE a (\n  id INTEGER, -- the id; primary\n  name TEXT /* ; */\n);\n-- trailing comment\n",
+			stmts: []statement{{sql: "CREATE TABLE a (\n  id INTEGER, -- the id; primary\n  name TEXT /* ; */\n)", line: 1}},
+		},
+		{
+			name: "quotes",
+			sql:  "INSERT INTO a VALUES ('it''s; here', \"x;y\", `z;`);\n\nINSERT INTO a VALUES ('b');",
+			stmts: []statement{
+				{sql: "INSERT INTO a VALUES ('it''s; here', \"x;y\", `z;`)", line: 1},
+				{sql: "INSERT INTO a VALUES ('b')", line: 3},
+			},
+		},
+		{
+			name: "dollar quoting",
+			sql:  "CREATE FUNCTION f() RETURNS int AS $body$\nBEGIN\n  RETURN 1;\nEND;\n$body$ LANGUAGE plpgsql;\nSELECT $1, $$a;b$$;",
+			stmts: []statement{
+				{sql: "CREATE FUNCTION f() RETURNS int AS $body$\nBEGIN\n  RETURN 1;\nEND;\n$body$ LANGUAGE plpgsql", line: 1},
+				{sql: "SELECT $1, $$a;b$$", line: 6},
+			},
+		},
+		{
+			name: "trigger body",
+			sql:  "CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET c = CASE WHEN 1 THEN 2 END;\n  DELETE FROM d;\nEND;\nCREATE TABLE e (begin_at INT, end INT);",
+			stmts: []statement{
+				{sql: "CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET c = CASE WHEN 1 THEN 2 END;\n  DELETE FROM d;\nEND", line: 1},
+				{sql: "CREATE TABLE e (begin_at INT, end INT)", line: 5},
+			},
+		},
+		{
+			name: "mysql procedure",
+			sql:  "CREATE PROCEDURE p() BEGIN\n  IF 1 THEN SELECT 1; END IF;\nEND;\nBEGIN;",
+			stmts: []statement{
+				{sql: "CREATE PROCEDURE p() BEGIN\n  IF 1 THEN SELECT 1; END IF;\nEND", line: 1},
+				{sql: "BEGIN", line: 4},
+			},
+		},
+		{
+			name:      "no trailing semicolon and offset",
+			sql:       "\n\n  /* header\n comment */ DROP TABLE a",
+			firstLine: 10,
+			stmts:     []statement{{sql: "DROP TABLE a", line: 13}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			firstLine := max(test.firstLine, 1)
+			stmts, err := splitStatements(test.sql, firstLine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stmts) != len(test.stmts) {
+				t.Fatalf("expected %d statements, got %d: %q", len(test.stmts), len(stmts), stmts)
+			}
+			for i := range stmts {
+				if stmts[i] != test.stmts[i] {
+					t.Errorf("statement %d: expected %+v, got %+v", i, test.stmts[i], stmts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplitStatementsErrors(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT 'unterminated;",
+		"SELECT 1; /* unterminated",
+		"SELECT $a$ unterminated",
+		"CREATE TRIGGER t BEGIN SELECT 1;",
+	} {
+		if _, err := splitStatements(sql, 1); err == nil {
+			t.Errorf("expected error for %q", sql)
+		}
+	}
+}
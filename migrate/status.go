@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+)
+
+type State string
+
+const (
+	StateApplied State = "applied"
+	StatePending State = "pending"
+	// StateMissing is an applied migration whose file no longer exists.
+	StateMissing State = "missing"
+	// StateOutOfOrder is a pending migration that sorts before the latest applied one.
+	StateOutOfOrder State = "out_of_order"
+)
+
+type MigrationStatus struct {
+	Version string
+	State   State
+	// AppliedAt is zero for pending migrations and migrations applied before it was tracked.
+	AppliedAt time.Time
+	// Checksum is the SHA-256 of the up section of the file, empty if the file is missing.
+	Checksum string
+	// AppliedChecksum is the checksum recorded when the migration was applied.
+	AppliedChecksum string
+}
+
+// Changed reports whether the file of an applied migration was edited after it was applied.
+func (s MigrationStatus) Changed() bool {
+	return s.Checksum != "" && s.AppliedChecksum != "" && s.Checksum != s.AppliedChecksum
+}
+
+// Status returns every migration in dir or the db ordered by version.
+func Status(ctx context.Context, dir fs.FS, db *sql.DB) ([]MigrationStatus, error) {
+	return (&Migrator{}).Status(ctx, dir, db)
+}
+
+// Plan returns the steps Migrate would run without running them.
+func Plan(ctx context.Context, dir fs.FS, db *sql.DB) ([]Step, error) {
+	return (&Migrator{}).Plan(ctx, dir, db)
+}
+
+func (m *Migrator) inspect(ctx context.Context, dir fs.FS, db *sql.DB) ([]string, []appliedVersion, error) {
+	names, err := m.migrationNames(ctx, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Status and Plan only read, so the migrations table is not created or upgraded
+	applied, err := m.readMigratedVersions(ctx, db)
+	if err != nil {
+		return nil, nil, err
+	}
+	return names, applied, nil
+}
+
+func (m *Migrator) Status(ctx context.Context, dir fs.FS, db *sql.DB) ([]MigrationStatus, error) {
+	names, applied, err := m.inspect(ctx, dir, db)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[string]*MigrationStatus)
+	latest := ""
+	for _, a := range applied {
+		byVersion[a.version] = &MigrationStatus{Version: a.version, State: StateMissing, AppliedAt: a.appliedAt, AppliedChecksum: a.checksum}
+		latest = max(latest, a.version)
+	}
+	for _, name := range names {
+		mig, err := m.load(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := byVersion[name]
+		if ok {
+			s.State = StateApplied
+		} else {
+			s = &MigrationStatus{Version: name, State: StatePending}
+			if name < latest {
+				s.State = StateOutOfOrder
+			}
+			byVersion[name] = s
+		}
+		s.Checksum = mig.checksum
+	}
+	res := make([]MigrationStatus, 0, len(byVersion))
+	for _, s := range byVersion {
+		res = append(res, *s)
+	}
+	slices.SortFunc(res, func(a, b MigrationStatus) int {
+		return strings.Compare(a.Version, b.Version)
+	})
+	return res, nil
+}
+
+func (m *Migrator) Plan(ctx context.Context, dir fs.FS, db *sql.DB) ([]Step, error) {
+	names, applied, err := m.inspect(ctx, dir, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verifyChecksums(ctx, dir, names, applied); err != nil {
+		return nil, err
+	}
+	return m.planTo(ctx, dir, names, versions(applied), "")
+}
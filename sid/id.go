@@ -2,38 +2,38 @@ package sid
 
 import (
 	"crypto/rand"
-	"github.com/SimonSchneider/goslu/syncu"
-	"math/big"
-	"slices"
+	"strings"
 )
 
-var bufPool = syncu.NewPool(func() []byte { return make([]byte, 0) })
-
 const letters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-"
-const lettersLen = int64(len(letters))
 
-var lettersBigLen = big.NewInt(lettersLen)
+// letterMask covers all indexes of letters, random bytes are masked and values outside of letters are rejected so every
+// letter is equally likely.
+const letterMask = 1<<6 - 1
 
-func bufWithLen(n int) []byte {
-	buf := bufPool.Get()
-	if cap(buf) < n {
-		buf = slices.Grow(buf, n-len(buf))
-	}
-	return buf[:n]
-}
+// randBatch is the number of random bytes read at a time, with 63 letters only 1 in 64 bytes is rejected.
+const randBatch = 64
 
 func NewString(n int) (string, error) {
-	buf := bufWithLen(n)
-	for i := 0; i < n; i++ {
-		num, err := rand.Int(rand.Reader, lettersBigLen)
-		if err != nil {
+	var rnd [randBatch]byte
+	b := strings.Builder{}
+	b.Grow(n)
+	for b.Len() < n {
+		// read a few extra bytes to usually cover the rejected ones in a single read
+		batch := rnd[:min(randBatch, n-b.Len()+n/32+1)]
+		if _, err := rand.Read(batch); err != nil {
 			return "", err
 		}
-		buf[i] = letters[num.Int64()]
+		for _, r := range batch {
+			if idx := int(r & letterMask); idx < len(letters) {
+				b.WriteByte(letters[idx])
+				if b.Len() == n {
+					break
+				}
+			}
+		}
 	}
-	ret := string(buf)
-	bufPool.Put(buf)
-	return ret, nil
+	return b.String(), nil
 }
 
 func MustNewString(n int) string {
@@ -2,6 +2,7 @@ package sid
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -9,3 +10,45 @@ func TestNew(t *testing.T) {
 	id := MustNewString(5)
 	fmt.Println(id)
 }
+
+func TestNewString(t *testing.T) {
+	counts := make(map[rune]int)
+	for _, n := range []int{0, 1, 16, 63, 64, 65, 200} {
+		id, err := NewString(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != n {
+			t.Errorf("expected length %d, got %d", n, len(id))
+		}
+		for _, c := range id {
+			if !strings.ContainsRune(letters, c) {
+				t.Errorf("unexpected character %q in %s", c, id)
+			}
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		for _, c := range MustNewString(63) {
+			counts[c]++
+		}
+	}
+	// every letter is expected 1000 times, allow a generous deviation to keep the test stable
+	for _, c := range letters {
+		if counts[c] < 700 || counts[c] > 1300 {
+			t.Errorf("letter %q occurred %d times", c, counts[c])
+		}
+	}
+}
+
+func BenchmarkNewString(b *testing.B) {
+	for _, n := range []int{8, 16, 32, 128} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := NewString(n); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}